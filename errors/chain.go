@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package errors
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Cause chain utilities.
+//
+// An error's cause is obtained per its Unwrap() error method (e.g. typed
+// errors with an error arg, fmt.Errorf with %w, errors recovered by the
+// panics package) or, alternatively, a Cause() error method. Errors with
+// multiple causes (Unwrap() []error) are branches of the cause tree.
+//
+// usage example:
+//    import "kriterium/errors"
+//    ...
+//    data, e := readConfig(filename)
+//    if e != nil {
+//        if errors.Find(e, errors.IllegalArgument) != nil {
+//            ...
+//        }
+//        log.Printf("readConfig failed - root cause: %s", errors.RootCause(e))
+//        log.Print(errors.FormatChain(e, false))
+//    }
+
+// maximum depth of a cause chain walk. Guards against cyclic chains.
+const maxChainDepth = 100
+
+// Returns the cause chain of the input arg 'e', starting with 'e'
+// itself and ending with its root cause. Only the first branch of
+// errors with multiple causes is followed.
+//
+// Returns nil if 'e' is nil.
+func Chain(e error) []error {
+	var chain []error
+	for ; e != nil && len(chain) < maxChainDepth; e = unwrap(e) {
+		chain = append(chain, e)
+	}
+	return chain
+}
+
+// Returns the root (innermost) cause of the input arg 'e', per Chain().
+// If 'e' has no cause, it is returned as is.
+func RootCause(e error) error {
+	chain := Chain(e)
+	if len(chain) == 0 {
+		return nil
+	}
+	return chain[len(chain)-1]
+}
+
+// Returns the first error in the cause tree of input arg 'e' that was
+// generated by the TypedError 'te', per TypedError.Matches(), or nil if
+// there is no such error. The tree is searched depth first.
+func Find(e error, te TypedError) error {
+	return find(e, te.Code(), 0)
+}
+
+func find(e error, code string, depth int) error {
+	if e == nil || depth >= maxChainDepth {
+		return nil
+	}
+	if hasCode(e, code) {
+		return e
+	}
+	for _, cause := range causes(e) {
+		if found := find(cause, code, depth+1); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Returns the cause tree of input arg 'e' rendered as an indented
+// "caused by:" tree, e.g.:
+//
+//    error: IOError: failed to load config
+//      caused by: open config.json: no such file or directory
+//
+// If input arg 'stacks' is true, the stack of every error in the tree
+// that provides one (per a Stack() []byte method) is included.
+//
+// Consecutive errors in the chain with identical messages are only
+// rendered once.
+func FormatChain(e error, stacks bool) string {
+	var buf bytes.Buffer
+	formatChain(&buf, e, "", "", stacks, 0)
+	return buf.String()
+}
+
+func formatChain(buf *bytes.Buffer, e error, indent, prev string, stacks bool, depth int) {
+	if e == nil || depth >= maxChainDepth {
+		return
+	}
+
+	msg := e.Error()
+	if msg != prev || depth == 0 {
+		if depth > 0 {
+			indent += "  "
+			buf.WriteString(indent + "caused by: ")
+		}
+		buf.WriteString(msg + "\n")
+		if st, ok := e.(interface{ Stack() []byte }); ok && stacks {
+			for _, line := range strings.Split(strings.TrimRight(string(st.Stack()), "\n"), "\n") {
+				buf.WriteString(indent + "    " + line + "\n")
+			}
+		}
+	}
+	for _, cause := range causes(e) {
+		formatChain(buf, cause, indent, msg, stacks, depth+1)
+	}
+}
+
+// internal - returns the immediate cause of 'e', if any.
+func unwrap(e error) error {
+	switch t := e.(type) {
+	case interface{ Unwrap() error }:
+		return t.Unwrap()
+	case interface{ Cause() error }:
+		return t.Cause()
+	case interface{ Unwrap() []error }:
+		if errs := t.Unwrap(); len(errs) > 0 {
+			return errs[0]
+		}
+	}
+	return nil
+}
+
+// internal - returns all immediate causes of 'e', if any.
+func causes(e error) []error {
+	if t, ok := e.(interface{ Unwrap() []error }); ok {
+		return t.Unwrap()
+	}
+	if cause := unwrap(e); cause != nil {
+		return []error{cause}
+	}
+	return nil
+}
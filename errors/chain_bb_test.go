@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package errors_test
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"strings"
+	"testing"
+)
+
+// ------------------------------------------------------------
+// errors cause chain: black-box tests
+// ------------------------------------------------------------
+
+var errIO = errors.New("IOError")
+
+// chain: typed -> %w -> typed -> root
+func testChain() (root, e error) {
+	root = fmt.Errorf("no such file")
+	e = errIO("open", root)
+	e = fmt.Errorf("loading config: %w", e)
+	e = errors.IllegalState("init failed", e)
+	return
+}
+
+func TestChain(t *testing.T) {
+	root, e := testChain()
+	chain := errors.Chain(e)
+	if len(chain) != 4 {
+		t.Fatalf("Chain - expected len:%d have:%d - %q", 4, len(chain), chain)
+	}
+	if chain[0] != e || chain[3] != root {
+		t.Fatalf("Chain - unexpected chain %q", chain)
+	}
+	if errors.Chain(nil) != nil {
+		t.Fatal("Chain(nil) - expected nil")
+	}
+}
+
+func TestRootCause(t *testing.T) {
+	root, e := testChain()
+	if have := errors.RootCause(e); have != root {
+		t.Fatalf("RootCause - expected:%q have:%q", root, have)
+	}
+	if have := errors.RootCause(root); have != root {
+		t.Fatalf("RootCause - expected:%q have:%q", root, have)
+	}
+}
+
+func TestFind(t *testing.T) {
+	_, e := testChain()
+	found := errors.Find(e, errIO)
+	if found == nil || !errIO.Matches(found) {
+		t.Fatalf("Find - expected IOError have:%v", found)
+	}
+	if found := errors.Find(e, errors.Usage); found != nil {
+		t.Fatalf("Find - expected nil have:%v", found)
+	}
+}
+
+// TypedErrors not generated per errors.New are found per Matches()
+func TestFindHandWritten(t *testing.T) {
+	var custom errors.TypedError = func(args ...interface{}) error {
+		return fmt.Errorf("error: custom error")
+	}
+	cause := custom()
+	e := errors.IllegalState("init failed", fmt.Errorf("loading config: %w", cause))
+	if found := errors.Find(e, custom); !custom.Matches(e) || found != cause {
+		t.Fatalf("Find - expected %q have:%v", cause, found)
+	}
+	if found := errors.Find(e, errIO); found != nil {
+		t.Fatalf("Find - expected nil have:%v", found)
+	}
+}
+
+func TestFormatChain(t *testing.T) {
+	_, e := testChain()
+	have := errors.FormatChain(e, false)
+	lines := strings.Split(strings.TrimRight(have, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("FormatChain - expected 4 lines have:\n%s", have)
+	}
+	for i, line := range lines[1:] {
+		prefix := strings.Repeat("  ", i+1) + "caused by: "
+		if !strings.HasPrefix(line, prefix) {
+			t.Fatalf("FormatChain - line %d expected prefix %q have:\n%s", i+1, prefix, have)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	if errors.Join() != nil || errors.Join(nil, nil) != nil {
+		t.Fatal("Join - expected nil")
+	}
+
+	_, e1 := testChain()
+	e2 := errors.Usage("bad flag")
+	e := errors.Join(e1, nil, e2)
+	if !errors.Multiple.Matches(e) || errors.CodeOf(e) != errors.Multiple.Code() {
+		t.Fatalf("Join - expected multiple errors have:%q", e)
+	}
+	if !errors.Usage.Matches(e) || errors.Find(e, errIO) == nil {
+		t.Fatalf("Join - expected joined errors to match have:%q", e)
+	}
+	if errs := errors.Errors(e); len(errs) != 2 || errs[0] != e1 || errs[1] != e2 {
+		t.Fatalf("Errors - unexpected errors:%q", errs)
+	}
+	if lines := strings.Count(errors.FormatChain(e, false), "caused by:"); lines != 5 {
+		t.Fatalf("FormatChain - expected %d causes have:\n%s", 5, errors.FormatChain(e, false))
+	}
+}
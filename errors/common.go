@@ -40,4 +40,14 @@ var (
 	ConcurrentAccess               = New("concurrent accession error")
 	ConcurrentOperation            = New("concurrent operation error")
 	TemplateExecute                = New("template execute error")
+	Supervision                    = New("supervision error")
+	Runtime                        = New("runtime panic") // see runtime.Error
+	Precondition                   = New("precondition violation")
+	Postcondition                  = New("postcondition violation")
+	Invariant                      = New("invariant violation")
+	Canceled                       = New("canceled error") // see context.Canceled
+	DeadlineExceeded               = New("deadline exceeded error")
+	Retry                          = New("retry error")
+	Callback                       = New("callback error")
+	Multiple                       = New("multiple errors") // see Join()
 )
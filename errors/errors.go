@@ -59,6 +59,9 @@ type TypedError func(args ...interface{}) error
 // If no args are provided, the generator function simply returns an error
 // using the errcode provided and omits the ':' decoration after the errcode.
 //
+// If any of the args is an error, the first such is recorded as the cause
+// of the generated error. See Chain(), RootCause().
+//
 // Usage examples:
 //
 //    import "kriterium/errors"
@@ -96,19 +99,29 @@ type TypedError func(args ...interface{}) error
 //    }
 func New(errcode string) TypedError {
 	return func(args ...interface{}) error {
+		if len(args) == 1 {
+			if _, ok := args[0].(probe); ok {
+				return &coded{code: errcode, msg: prefix + errcode}
+			}
+		}
+
 		decoration := ""
 		if len(args) > 0 {
 			decoration = ": "
 		}
 
+		var cause error
 		msg := []byte(prefix + errcode + decoration)
 		for _, arg := range args {
+			if e, ok := arg.(error); ok && cause == nil {
+				cause = e
+			}
 			msg = append(msg, []byte(fmt.Sprintf("%v", arg))...)
 			msg = append(msg, []byte(" ")...)
 		}
 
-		e := estr(string(msg))
-		return &e
+		countCreated(errcode)
+		return &coded{code: errcode, msg: string(msg), cause: cause}
 	}
 }
 
@@ -151,28 +164,77 @@ func New(errcode string) TypedError {
 //        }
 //        ...
 //    }
+//
+// If the error itself does not match, its causes (see Chain(), Join())
+// are checked, so that e.g. errors recovered by the panics package match
+// the TypedError of their cause.
 func (fn TypedError) Matches(e error) bool {
-	if e == nil {
+	return matches(e, fn.Code(), 0)
+}
+
+func matches(e error, errcode string, depth int) bool {
+	if e == nil || depth >= maxChainDepth {
 		return false
 	}
-	errcode := fn.Code()
+	if hasCode(e, errcode) {
+		return true
+	}
+	for _, cause := range causes(e) {
+		if matches(cause, errcode, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the error 'e' itself (not its causes) has the error
+// code 'errcode', per its message.
+func hasCode(e error, errcode string) bool {
 	codelen := len(errcode)
 	e0 := e.Error()
-	if len(e0) < codelen {
-		return false
-	}
-	return errcode == e0[prefixlen:codelen+prefixlen]
+	return len(e0) >= codelen+prefixlen && errcode == e0[prefixlen:codelen+prefixlen]
 }
 
 // Returns the error code of this TypeError.
 func (fn TypedError) Code() string {
+	if e, ok := fn(probe{}).(*coded); ok {
+		return e.code
+	}
+	// not generated per New(): the code is the message sans prefix
 	return fn().Error()[prefixlen:]
 }
 
+// Returns the error code of the input arg 'e', if it is (or wraps) an
+// error generated by a TypedError. Otherwise returns "".
+func CodeOf(e error) string {
+	for ; e != nil; e = unwrap(e) {
+		switch t := e.(type) {
+		case *coded:
+			return t.code
+		case *joined:
+			return Multiple.Code()
+		}
+	}
+	return ""
+}
+
+// internal marker arg used by Code() to obtain the error code without
+// the side-effects (e.g. metrics) of generating an error.
+type probe struct{}
+
 // internal
-type estr string
+type coded struct {
+	code  string
+	msg   string
+	cause error // first error arg, if any
+}
+
+// internal
+func (e *coded) Error() string {
+	return e.msg
+}
 
 // internal
-func (e *estr) Error() string {
-	return string(*e)
+func (e *coded) Unwrap() error {
+	return e.cause
 }
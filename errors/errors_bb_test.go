@@ -18,6 +18,7 @@
 package errors_test
 
 import (
+	"fmt"
 	"github.com/elasticsearch/kriterium/errors"
 	"testing"
 	"testing/quick"
@@ -44,6 +45,21 @@ func TestTypedError_Code(t *testing.T) {
 	}
 }
 
+// TypedErrors not generated per errors.New: the code is the message
+// sans prefix
+func TestTypedError_CodeHandWritten(t *testing.T) {
+	var custom errors.TypedError = func(args ...interface{}) error {
+		return fmt.Errorf("error: custom error")
+	}
+	if code := custom.Code(); code != "custom error" {
+		t.Fatalf("Code - expected:%q have:%q", "custom error", code)
+	}
+	wrapped := errors.Assertion("check", custom())
+	if !custom.Matches(custom()) || !custom.Matches(wrapped) || custom.Matches(errors.Assertion()) {
+		t.Fatal("Matches - unexpected result")
+	}
+}
+
 // quick check that TypedError#Matches
 func TestTypedError_Matches(t *testing.T) {
 	testCodeFn := func(code, extra string) bool {
@@ -69,3 +85,17 @@ func TestTypedError_MatchesNilArg(t *testing.T) {
 		t.Fatalf("TypedError.Matches(nil) - expected:%t have:%t\n", expected, have)
 	}
 }
+
+// check that TypedError#Matches checks the cause chain, and never panics
+// on short error messages
+func TestTypedError_MatchesChain(t *testing.T) {
+	et := errors.New("any")
+	e := fmt.Errorf("wrapped: %w", et("cause"))
+	if !et.Matches(e) {
+		t.Fatalf("TypedError.Matches(%q) - expected:%t have:%t\n", e, true, false)
+	}
+	short := fmt.Errorf("any-")
+	if et.Matches(short) {
+		t.Fatalf("TypedError.Matches(%q) - expected:%t have:%t\n", short, false, true)
+	}
+}
@@ -0,0 +1,212 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Per error code metrics.
+//
+// Metrics are opt-in. Once a Counters registry is enabled, every error
+// generated by a TypedError is counted as 'created', and every typed
+// error recovered by the panics package is counted as 'recovered'.
+//
+// usage example:
+//    import "kriterium/errors"
+//    ...
+//    counters := errors.NewCounters("my-service")
+//    errors.EnableMetrics(counters)
+//
+//    // prometheus scrape endpoint
+//    http.Handle("/metrics", counters)
+//
+//    // expvar (counters implements expvar.Var)
+//    expvar.Publish("errors", counters)
+
+// Counter events.
+const (
+	Created   = "created"
+	Recovered = "recovered"
+)
+
+// Prometheus metric name of the exposed counters.
+const metricName = "kriterium_errors_total"
+
+// the active registry, if any.
+var metrics atomic.Pointer[Counters]
+
+// Counters is a registry of error counts, labelled by namespace, event
+// and error code. It is safe for concurrent use.
+type Counters struct {
+	namespace string
+	mu        sync.RWMutex
+	counts    map[counterKey]*uint64
+}
+
+type counterKey struct {
+	event, code string
+}
+
+// Returns a new (empty) Counters registry. Input arg 'namespace' is
+// applied as the 'namespace' label of all counts.
+func NewCounters(namespace string) *Counters {
+	return &Counters{
+		namespace: namespace,
+		counts:    make(map[counterKey]*uint64),
+	}
+}
+
+// Installs the input arg 'c' as the active registry. A nil 'c' is
+// equivalent to DisableMetrics().
+func EnableMetrics(c *Counters) {
+	metrics.Store(c)
+}
+
+// Disables metrics. Counts of the previously active registry, if any,
+// are retained.
+func DisableMetrics() {
+	metrics.Store(nil)
+}
+
+// CountRecovered counts the input arg 'e' as a 'recovered' event in
+// the active registry, if any. Errors that are not typed are ignored.
+//
+// This function is used by the panics package and is typically not
+// called directly.
+func CountRecovered(e error) {
+	c := metrics.Load()
+	if c == nil {
+		return
+	}
+	if code := CodeOf(e); code != "" {
+		c.Inc(Recovered, code)
+	}
+}
+
+// internal - called on generation of typed errors.
+func countCreated(code string) {
+	if c := metrics.Load(); c != nil {
+		c.Inc(Created, code)
+	}
+}
+
+// Increments the count for the given event and error code.
+func (c *Counters) Inc(event, code string) {
+	key := counterKey{event, code}
+
+	c.mu.RLock()
+	n, ok := c.counts[key]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if n, ok = c.counts[key]; !ok {
+			n = new(uint64)
+			c.counts[key] = n
+		}
+		c.mu.Unlock()
+	}
+	atomic.AddUint64(n, 1)
+}
+
+// Returns the current count for the given event and error code.
+func (c *Counters) Count(event, code string) uint64 {
+	c.mu.RLock()
+	n, ok := c.counts[counterKey{event, code}]
+	c.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(n)
+}
+
+// Returns a snapshot of all counts, keyed by event and then error code.
+func (c *Counters) Snapshot() map[string]map[string]uint64 {
+	snapshot := make(map[string]map[string]uint64)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for key, n := range c.counts {
+		codes, ok := snapshot[key.event]
+		if !ok {
+			codes = make(map[string]uint64)
+			snapshot[key.event] = codes
+		}
+		codes[key.code] = atomic.LoadUint64(n)
+	}
+	return snapshot
+}
+
+// WriteTo writes the counts in Prometheus text exposition format.
+func (c *Counters) WriteTo(w io.Writer) (int64, error) {
+	type sample struct {
+		key counterKey
+		n   uint64
+	}
+	c.mu.RLock()
+	samples := make([]sample, 0, len(c.counts))
+	for key, n := range c.counts {
+		samples = append(samples, sample{key, atomic.LoadUint64(n)})
+	}
+	c.mu.RUnlock()
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].key.event != samples[j].key.event {
+			return samples[i].key.event < samples[j].key.event
+		}
+		return samples[i].key.code < samples[j].key.code
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# HELP %s Number of kriterium typed errors by event and code.\n", metricName)
+	fmt.Fprintf(&buf, "# TYPE %s counter\n", metricName)
+	for _, s := range samples {
+		fmt.Fprintf(&buf, "%s{namespace=\"%s\",event=\"%s\",code=\"%s\"} %d\n",
+			metricName, escapeLabel(c.namespace), escapeLabel(s.key.event), escapeLabel(s.key.code), s.n)
+	}
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP exposes the counts in Prometheus text exposition format.
+func (c *Counters) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// String returns the counts as a JSON object, keyed by event and then
+// error code. Per this method, Counters implements expvar.Var.
+func (c *Counters) String() string {
+	b, e := json.Marshal(c.Snapshot())
+	if e != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// label value escaping per Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package errors_test
+
+import (
+	"encoding/json"
+	"github.com/elasticsearch/kriterium/errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ------------------------------------------------------------
+// errors metrics: black-box tests
+// ------------------------------------------------------------
+
+func TestCounters_Created(t *testing.T) {
+	counters := errors.NewCounters("test")
+	errors.EnableMetrics(counters)
+	defer errors.DisableMetrics()
+
+	woof := errors.New("woof")
+	for i := 0; i < 3; i++ {
+		woof("bark", i)
+	}
+	woof.Code() // must not count
+	woof.Matches(woof())
+
+	if have := counters.Count(errors.Created, "woof"); have != 4 {
+		t.Fatalf("Counters.Count - expected:%d have:%d\n", 4, have)
+	}
+
+	errors.CountRecovered(woof())
+	errors.CountRecovered(nil)
+	if have := counters.Count(errors.Recovered, "woof"); have != 1 {
+		t.Fatalf("Counters.Count - expected:%d have:%d\n", 1, have)
+	}
+}
+
+func TestCounters_Disabled(t *testing.T) {
+	counters := errors.NewCounters("test")
+	errors.EnableMetrics(counters)
+	errors.DisableMetrics()
+
+	errors.New("meow")()
+	if have := counters.Count(errors.Created, "meow"); have != 0 {
+		t.Fatalf("Counters.Count - expected:%d have:%d\n", 0, have)
+	}
+}
+
+func TestCounters_ServeHTTP(t *testing.T) {
+	counters := errors.NewCounters("test")
+	counters.Inc(errors.Created, "io error")
+	counters.Inc(errors.Created, "io error")
+	counters.Inc(errors.Recovered, `say "what"`)
+
+	server := httptest.NewServer(counters)
+	defer server.Close()
+
+	resp, e := server.Client().Get(server.URL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer resp.Body.Close()
+	body, e := ioutil.ReadAll(resp.Body)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if ctype := resp.Header.Get("Content-Type"); !strings.HasPrefix(ctype, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ctype)
+	}
+	expected := []string{
+		`# TYPE kriterium_errors_total counter`,
+		`kriterium_errors_total{namespace="test",event="created",code="io error"} 2`,
+		`kriterium_errors_total{namespace="test",event="recovered",code="say \"what\""} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("expected line %q in exposition:\n%s", line, body)
+		}
+	}
+}
+
+func TestCounters_Expvar(t *testing.T) {
+	counters := errors.NewCounters("test")
+	counters.Inc(errors.Created, "io error")
+
+	var have map[string]map[string]uint64
+	if e := json.Unmarshal([]byte(counters.String()), &have); e != nil {
+		t.Fatal(e)
+	}
+	if have[errors.Created]["io error"] != 1 {
+		t.Fatalf("unexpected expvar value %s", counters.String())
+	}
+}
@@ -0,0 +1,90 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns an errors.Multiple error with all non-nil input args 'errs' as
+// its causes, or nil if there are none.
+//
+// The joined errors are obtained per Errors(). Matches(), Find() and
+// FormatChain() consider all of the joined errors.
+//
+// usage example:
+//    import "kriterium/errors"
+//    ...
+//    var errs []error
+//    for _, file := range files {
+//        if e := check(file); e != nil {
+//            errs = append(errs, e)
+//        }
+//    }
+//    return errors.Join(errs...)
+func Join(errs ...error) error {
+	var nonnil []error
+	for _, e := range errs {
+		if e != nil {
+			nonnil = append(nonnil, e)
+		}
+	}
+	if len(nonnil) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(nonnil))
+	for i, e := range nonnil {
+		msgs[i] = e.Error()
+	}
+	countCreated(Multiple.Code())
+	msg := fmt.Sprintf("%s%s: %d errors: [%s]", prefix, Multiple.Code(), len(nonnil), strings.Join(msgs, "; "))
+	return &joined{msg, nonnil}
+}
+
+// Returns the joined errors of input arg 'e', if it is an error returned
+// by Join(). Otherwise returns a slice with 'e' itself, or nil if 'e'
+// is nil.
+func Errors(e error) []error {
+	if e == nil {
+		return nil
+	}
+	if j, ok := e.(*joined); ok {
+		errs := make([]error, len(j.errs))
+		copy(errs, j.errs)
+		return errs
+	}
+	return []error{e}
+}
+
+// internal
+type joined struct {
+	msg  string
+	errs []error
+}
+
+// internal
+func (e *joined) Error() string {
+	return e.msg
+}
+
+// internal
+func (e *joined) Unwrap() []error {
+	return e.errs
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package assert_test
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"github.com/elasticsearch/kriterium/panics/assert"
+	"strings"
+	"testing"
+)
+
+func recoverFrom(fn func()) (err error) {
+	defer panics.Recover(&err)
+	fn()
+	return
+}
+
+func TestAssertions(t *testing.T) {
+	failing := map[string]func(){
+		"True":        func() { assert.True(false, "true") },
+		"False":       func() { assert.False(true, "false") },
+		"NotNil":      func() { assert.NotNil(nil, "not nil") },
+		"NoError":     func() { assert.NoError(fmt.Errorf("woof"), "no error") },
+		"Equal":       func() { assert.Equal(1, 2, "equal") },
+		"InRange":     func() { assert.InRange(3, 1, 2, "in range") },
+		"That":        func() { assert.That(func() bool { return false }, "that") },
+		"NoErrorFunc": func() { assert.NoErrorFunc(func() error { return fmt.Errorf("woof") }, "no error func") },
+	}
+	for name, fn := range failing {
+		e := recoverFrom(fn)
+		if !assert.Enabled {
+			if e != nil {
+				t.Fatalf("%s - expected no-op have:%v", name, e)
+			}
+			continue
+		}
+		if e == nil {
+			t.Fatalf("%s - expected assertion failure", name)
+		}
+		rp := e.(*panics.Recovered)
+		if !strings.Contains(rp.Site.Func, "TestAssertions") {
+			t.Fatalf("%s - unexpected site:%s", name, rp.Site)
+		}
+	}
+}
+
+func TestAssertionsTyped(t *testing.T) {
+	e := recoverFrom(func() { assert.True(false, "typed") })
+	if assert.Enabled != errors.Assertion.Matches(e) {
+		t.Fatalf("expected assertion error:%t have:%v", assert.Enabled, e)
+	}
+}
+
+func TestLazyAssertions(t *testing.T) {
+	evaluated := false
+	assert.That(func() bool {
+		evaluated = true
+		return true
+	})
+	if evaluated != assert.Enabled {
+		t.Fatalf("expected evaluated:%t", assert.Enabled)
+	}
+}
@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build kriterium_debug
+
+package assert
+
+import (
+	"github.com/elasticsearch/kriterium/panics"
+)
+
+// true if assertions are live, i.e. per the kriterium_debug build tag.
+const Enabled = true
+
+// Asserts that 'cond' is true. See panics.OnFalse().
+func True(cond bool, info ...interface{}) {
+	panics.OnFalse(cond, info...)
+}
+
+// Asserts that 'cond' is false. See panics.OnTrue().
+func False(cond bool, info ...interface{}) {
+	panics.OnTrue(cond, info...)
+}
+
+// Asserts that 'v' is not nil. See panics.OnNil().
+func NotNil(v interface{}, info ...interface{}) {
+	panics.OnNil(v, info...)
+}
+
+// Asserts that 'e' is nil. See panics.OnError().
+func NoError(e error, info ...interface{}) {
+	panics.OnError(e, info...)
+}
+
+// Asserts that 'want' and 'got' are equal. See panics.OnNotEqual().
+func Equal(want, got interface{}, info ...interface{}) {
+	panics.OnNotEqual(want, got, info...)
+}
+
+// Asserts that 'v' is in the (inclusive) range ['lo', 'hi']. See
+// panics.OnOutOfRange().
+func InRange(v, lo, hi interface{}, info ...interface{}) {
+	panics.OnOutOfRange(v, lo, hi, info...)
+}
+
+// Lazy variant of True(): 'cond' is only evaluated in debug builds.
+func That(cond func() bool, info ...interface{}) {
+	panics.OnFalse(cond(), info...)
+}
+
+// Lazy variant of NoError(): 'fn' is only evaluated in debug builds.
+func NoErrorFunc(fn func() error, info ...interface{}) {
+	panics.OnError(fn(), info...)
+}
@@ -0,0 +1,47 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !kriterium_debug
+
+package assert
+
+// true if assertions are live, i.e. per the kriterium_debug build tag.
+const Enabled = false
+
+// No-op. See the kriterium_debug build.
+func True(cond bool, info ...interface{}) {}
+
+// No-op. See the kriterium_debug build.
+func False(cond bool, info ...interface{}) {}
+
+// No-op. See the kriterium_debug build.
+func NotNil(v interface{}, info ...interface{}) {}
+
+// No-op. See the kriterium_debug build.
+func NoError(e error, info ...interface{}) {}
+
+// No-op. See the kriterium_debug build.
+func Equal(want, got interface{}, info ...interface{}) {}
+
+// No-op. See the kriterium_debug build.
+func InRange(v, lo, hi interface{}, info ...interface{}) {}
+
+// No-op: 'cond' is not evaluated. See the kriterium_debug build.
+func That(cond func() bool, info ...interface{}) {}
+
+// No-op: 'fn' is not evaluated. See the kriterium_debug build.
+func NoErrorFunc(fn func() error, info ...interface{}) {}
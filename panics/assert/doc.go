@@ -0,0 +1,38 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// package assert provides debug assertions that compile out of release
+// builds.
+//
+// Assertions are live only in builds with the kriterium_debug build tag:
+//
+//    go test -tags kriterium_debug ./...
+//
+// Otherwise, all assertions are no-ops. Live assertions panic per the
+// panics API, e.g. assert.True() per panics.OnFalse(), and are recovered
+// per panics.Recover().
+//
+// NOTE: Go evaluates the args of a call to a no-op function all the same.
+// For expensive conditions use the lazy variants (That, NoErrorFunc),
+// whose function arg is only evaluated in debug builds, or guard the
+// assertion per the Enabled constant:
+//
+//    func (s *sortedSet) insert(x int) {
+//        ...
+//        assert.That(func() bool { return sort.IntsAreSorted(s.items) }, "insert: sorted")
+//    }
+package assert
@@ -0,0 +1,475 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// panics API - value assertions
+// -----------------------------------------------------------------------
+
+// All value assertions panic with a *Recovered with an errors.Assertion
+// cause.
+
+// Asserts that input args 'want' and 'got' are equal, per
+// reflect.DeepEqual. If not, panics with a *Recovered with descriptive
+// message based on the 'info' n-aray input arg, and the values. For
+// values of different types, the message includes the types. For
+// composite values (structs, slices, maps, etc.) the message includes a
+// structural diff.
+func OnNotEqual(want, got interface{}, info ...interface{}) {
+	if reflect.DeepEqual(want, got) {
+		return
+	}
+	msg := fmt.Sprintf("%s - not equal: want %s got %s", fmtInfo(info...), fmtValue(want), fmtValue(got))
+	if reflect.TypeOf(want) != reflect.TypeOf(got) {
+		msg = fmt.Sprintf("%s - not equal: want %s (%T) got %s (%T)", fmtInfo(info...), fmtValue(want), want, fmtValue(got), got)
+	}
+	if lines := diff(want, got); len(lines) > 0 {
+		msg += "\n    diff:\n      " + strings.Join(lines, "\n      ")
+	}
+	raiseAs(errors.Assertion, KindNotEqual, msg, info)
+}
+
+// Asserts that input arg 'v' is in the (inclusive) range ['lo', 'hi'].
+// Numbers of any type, strings, time.Time and time.Duration values are
+// supported. If not in range, or the values are not comparable (e.g. a
+// NaN), panics with a *Recovered with descriptive message based on the
+// 'info' n-aray input arg, and the values.
+func OnOutOfRange(v, lo, hi interface{}, info ...interface{}) {
+	c0, ok0 := compare(v, lo)
+	c1, ok1 := compare(v, hi)
+	if !ok0 || !ok1 {
+		msg := fmt.Sprintf("%s - not comparable: %s (%T) range [%s (%T), %s (%T)]",
+			fmtInfo(info...), fmtValue(v), v, fmtValue(lo), lo, fmtValue(hi), hi)
+		raiseAs(errors.Assertion, KindOutOfRange, msg, info)
+	}
+	if c0 >= 0 && c1 <= 0 {
+		return
+	}
+	msg := fmt.Sprintf("%s - out of range: %s not in [%s, %s]", fmtInfo(info...), fmtValue(v), fmtValue(lo), fmtValue(hi))
+	raiseAs(errors.Assertion, KindOutOfRange, msg, info)
+}
+
+// Asserts that input arg 'v' is not empty. Strings, slices, arrays,
+// maps and channels are empty if of len 0; nil values (including typed
+// nils) are empty; any other value is empty if it is the zero value.
+// If empty, panics with a *Recovered with descriptive message based on
+// the 'info' n-aray input arg.
+func OnEmpty(v interface{}, info ...interface{}) {
+	if !isEmpty(v) {
+		return
+	}
+	msg := fmt.Sprintf("%s - value is empty: %s", fmtInfo(info...), fmtValue(v))
+	raiseAs(errors.Assertion, KindEmpty, msg, info)
+}
+
+// Asserts that the len of input arg 'v' is 'n'. If not, or 'v' has no
+// len, panics with a *Recovered with descriptive message based on the
+// 'info' n-aray input arg, and the actual len.
+func OnLenNot(v interface{}, n int, info ...interface{}) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		if rv.Len() == n {
+			return
+		}
+		msg := fmt.Sprintf("%s - len is not %d: len %d", fmtInfo(info...), n, rv.Len())
+		raiseAs(errors.Assertion, KindLenNot, msg, info)
+	}
+	msg := fmt.Sprintf("%s - len is not %d: %T has no len", fmtInfo(info...), n, v)
+	raiseAs(errors.Assertion, KindLenNot, msg, info)
+}
+
+// Asserts that input arg 'v' is nil. Typed nils (e.g. a nil *T in an
+// interface{}) are nil. If not nil, panics with a *Recovered with
+// descriptive message based on the 'info' n-aray input arg, and the
+// value.
+func OnNotNil(v interface{}, info ...interface{}) {
+	if isNil(v) {
+		return
+	}
+	msg := fmt.Sprintf("%s - value is not nil: %s", fmtInfo(info...), fmtValue(v))
+	raiseAs(errors.Assertion, KindNotNil, msg, info)
+}
+
+// Asserts that input arg 's' matches the regular expression 're', which
+// is either a *regexp.Regexp or a string pattern. 's' is either a string,
+// a []byte, or a fmt.Stringer. If not matching, panics with a *Recovered
+// with descriptive message based on the 'info' n-aray input arg, and the
+// values.
+func OnNotMatching(re interface{}, s interface{}, info ...interface{}) {
+	var rx *regexp.Regexp
+	switch t := re.(type) {
+	case *regexp.Regexp:
+		rx = t
+	case string:
+		var e error
+		if rx, e = regexp.Compile(t); e != nil {
+			msg := fmt.Sprintf("%s - invalid pattern: %s", fmtInfo(info...), e)
+			raiseAs(errors.Assertion, KindNotMatching, msg, info)
+		}
+	default:
+		msg := fmt.Sprintf("%s - invalid pattern: %T", fmtInfo(info...), re)
+		raiseAs(errors.Assertion, KindNotMatching, msg, info)
+	}
+
+	var str string
+	switch t := s.(type) {
+	case string:
+		str = t
+	case []byte:
+		str = string(t)
+	case stringCodec:
+		str = t.String()
+	default:
+		msg := fmt.Sprintf("%s - not matching %q: %T is not a string", fmtInfo(info...), rx, s)
+		raiseAs(errors.Assertion, KindNotMatching, msg, info)
+	}
+	if rx.MatchString(str) {
+		return
+	}
+	msg := fmt.Sprintf("%s - not matching %q: %q", fmtInfo(info...), rx, str)
+	raiseAs(errors.Assertion, KindNotMatching, msg, info)
+}
+
+// -----------------------------------------------------------------------
+// panics.ForFunc - value assertions
+// -----------------------------------------------------------------------
+
+func (t *fnpanics) OnNotEqual(want, got interface{}, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnNotEqual(want, got, infofn...)
+}
+func (t *fnpanics) OnOutOfRange(v, lo, hi interface{}, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnOutOfRange(v, lo, hi, infofn...)
+}
+func (t *fnpanics) OnEmpty(v interface{}, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnEmpty(v, infofn...)
+}
+func (t *fnpanics) OnLenNot(v interface{}, n int, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnLenNot(v, n, infofn...)
+}
+func (t *fnpanics) OnNotNil(v interface{}, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnNotNil(v, infofn...)
+}
+func (t *fnpanics) OnNotMatching(re interface{}, s interface{}, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnNotMatching(re, s, infofn...)
+}
+
+// -----------------------------------------------------------------------
+// internal support
+// -----------------------------------------------------------------------
+
+// maximum number of diff lines included in OnNotEqual messages.
+const maxDiffLines = 20
+
+// formats values included in assertion messages.
+func fmtValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return fmt.Sprintf("%q", t)
+	case error:
+		return fmt.Sprintf("%T(%q)", t, t.Error())
+	case time.Time, time.Duration:
+		return fmt.Sprintf("%v", t)
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+// Returns true if 'v' is nil or a typed nil.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func, reflect.Interface, reflect.UnsafePointer:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Returns true if 'v' is empty per OnEmpty().
+func isEmpty(v interface{}) bool {
+	if isNil(v) {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+// Compares 'a' and 'b'. Returns -1, 0, +1 if 'a' is less, equal or
+// greater than 'b', and false if not comparable. NaN is not comparable.
+func compare(a, b interface{}) (int, bool) {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch {
+	case isString(va) && isString(vb):
+		return strings.Compare(va.String(), vb.String()), true
+	case isInt(va) && isInt(vb):
+		return cmp3(va.Int() < vb.Int(), va.Int() > vb.Int()), true
+	case isUint(va) && isUint(vb):
+		return cmp3(va.Uint() < vb.Uint(), va.Uint() > vb.Uint()), true
+	case isInt(va) && isUint(vb):
+		if va.Int() < 0 {
+			return -1, true
+		}
+		return cmp3(uint64(va.Int()) < vb.Uint(), uint64(va.Int()) > vb.Uint()), true
+	case isUint(va) && isInt(vb):
+		if vb.Int() < 0 {
+			return 1, true
+		}
+		return cmp3(va.Uint() < uint64(vb.Int()), va.Uint() > uint64(vb.Int())), true
+	case isNumber(va) && isNumber(vb):
+		fa, fb := toFloat(va), toFloat(vb)
+		if math.IsNaN(fa) || math.IsNaN(fb) {
+			return 0, false
+		}
+		return cmp3(fa < fb, fa > fb), true
+	}
+	return 0, false
+}
+
+func cmp3(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+func isString(v reflect.Value) bool {
+	return v.Kind() == reflect.String
+}
+
+func isInt(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUint(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func isNumber(v reflect.Value) bool {
+	return isInt(v) || isUint(v) || v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v):
+		return float64(v.Int())
+	case isUint(v):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+// Returns the structural diff of composite values 'want' and 'got', as
+// lines of "<path>: want <v> got <v>". Returns nil for non-composite
+// values.
+func diff(want, got interface{}) []string {
+	vw, vg := reflect.ValueOf(want), reflect.ValueOf(got)
+	if !isComposite(vw) && !isComposite(vg) {
+		return nil
+	}
+	var lines []string
+	diffValues(&lines, "", vw, vg, 0)
+	return lines
+}
+
+func isComposite(v reflect.Value) bool {
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
+
+func diffValues(lines *[]string, path string, want, got reflect.Value, depth int) {
+	if len(*lines) >= maxDiffLines {
+		return
+	}
+	if depth > 10 {
+		return
+	}
+	report := func() {
+		if len(*lines) == maxDiffLines-1 {
+			*lines = append(*lines, "...")
+			return
+		}
+		*lines = append(*lines, fmt.Sprintf("%s: want %s got %s", pathOrRoot(path), fmtReflect(want), fmtReflect(got)))
+	}
+
+	if !want.IsValid() || !got.IsValid() {
+		if want.IsValid() != got.IsValid() {
+			report()
+		}
+		return
+	}
+	if want.Type() != got.Type() {
+		*lines = append(*lines, fmt.Sprintf("%s: want type %s got type %s", pathOrRoot(path), want.Type(), got.Type()))
+		return
+	}
+
+	switch want.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if want.IsNil() || got.IsNil() {
+			if want.IsNil() != got.IsNil() {
+				report()
+			}
+			return
+		}
+		diffValues(lines, path, want.Elem(), got.Elem(), depth+1)
+	case reflect.Struct:
+		for i := 0; i < want.NumField(); i++ {
+			diffValues(lines, path+"."+want.Type().Field(i).Name, want.Field(i), got.Field(i), depth+1)
+		}
+	case reflect.Slice, reflect.Array:
+		if want.Kind() == reflect.Slice && want.IsNil() != got.IsNil() {
+			report()
+			return
+		}
+		n := want.Len()
+		if got.Len() > n {
+			n = got.Len()
+		}
+		for i := 0; i < n; i++ {
+			ipath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= want.Len():
+				diffValues(lines, ipath, reflect.Value{}, got.Index(i), depth+1)
+			case i >= got.Len():
+				diffValues(lines, ipath, want.Index(i), reflect.Value{}, depth+1)
+			default:
+				diffValues(lines, ipath, want.Index(i), got.Index(i), depth+1)
+			}
+		}
+	case reflect.Map:
+		if want.IsNil() != got.IsNil() {
+			report()
+			return
+		}
+		keys := append(want.MapKeys(), got.MapKeys()...)
+		sort.Slice(keys, func(i, j int) bool {
+			return fmtReflect(keys[i]) < fmtReflect(keys[j])
+		})
+		seen := make(map[string]bool)
+		for _, key := range keys {
+			kstr := fmtReflect(key)
+			if seen[kstr] {
+				continue
+			}
+			seen[kstr] = true
+			diffValues(lines, fmt.Sprintf("%s[%s]", path, kstr), want.MapIndex(key), got.MapIndex(key), depth+1)
+		}
+	default:
+		if !leafEqual(want, got) {
+			report()
+		}
+	}
+}
+
+// compares non-composite values. (Values of unexported fields can not
+// be obtained per Interface(), so values are compared per kind.)
+func leafEqual(a, b reflect.Value) bool {
+	switch {
+	case isInt(a):
+		return a.Int() == b.Int()
+	case isUint(a):
+		return a.Uint() == b.Uint()
+	}
+	switch a.Kind() {
+	case reflect.Bool:
+		return a.Bool() == b.Bool()
+	case reflect.String:
+		return a.String() == b.String()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() == b.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return a.Complex() == b.Complex()
+	case reflect.Func:
+		return a.IsNil() && b.IsNil()
+	case reflect.Chan, reflect.UnsafePointer:
+		return a.Pointer() == b.Pointer()
+	}
+	return false
+}
+
+func fmtReflect(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<missing>"
+	}
+	if v.Kind() == reflect.String {
+		return fmt.Sprintf("%q", v.String())
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
@@ -0,0 +1,102 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"github.com/elasticsearch/kriterium/panics"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X, Y int
+	tags []string
+}
+
+// runs fn and returns the recovered error, if any
+func recoverFrom(fn func()) (err error) {
+	defer panics.Recover(&err)
+	fn()
+	return
+}
+
+func TestValueAssertions(t *testing.T) {
+	var nilptr *point
+	var tests = []struct {
+		name  string
+		fail  bool
+		fn    func()
+		inmsg string
+	}{
+		{"equal", false, func() { panics.OnNotEqual([]int{1, 2}, []int{1, 2}) }, ""},
+		{"not-equal", true, func() { panics.OnNotEqual(1, 2, "n") }, "want 1 got 2"},
+		{"not-equal-type", true, func() { panics.OnNotEqual(1, int64(1)) }, "want 1 (int) got 1 (int64)"},
+		{"not-equal-diff", true, func() {
+			panics.OnNotEqual(point{1, 2, []string{"a"}}, point{1, 3, []string{"a", "b"}})
+		}, ".Y: want 2 got 3"},
+		{"not-equal-map", true, func() {
+			panics.OnNotEqual(map[string]int{"a": 1}, map[string]int{"a": 2, "b": 0})
+		}, `["b"]: want <missing> got 0`},
+		{"in-range", false, func() { panics.OnOutOfRange(5, 1, uint8(10)) }, ""},
+		{"in-range-float", false, func() { panics.OnOutOfRange(2.5, 1, 3) }, ""},
+		{"in-range-duration", false, func() { panics.OnOutOfRange(time.Second, time.Millisecond, time.Minute) }, ""},
+		{"out-of-range", true, func() { panics.OnOutOfRange(-1, 0, 10, "n") }, "out of range: -1 not in [0, 10]"},
+		{"out-of-range-string", true, func() { panics.OnOutOfRange("z", "a", "m") }, `"z" not in ["a", "m"]`},
+		{"not-comparable", true, func() { panics.OnOutOfRange("z", 1, 2) }, "not comparable"},
+		{"not-comparable-nan", true, func() { panics.OnOutOfRange(math.NaN(), 0, 10) }, "not comparable: NaN"},
+		{"not-empty", false, func() { panics.OnEmpty([]int{1}) }, ""},
+		{"empty-slice", true, func() { panics.OnEmpty([]int{}, "list") }, "value is empty"},
+		{"empty-typed-nil", true, func() { panics.OnEmpty(nilptr) }, "value is empty"},
+		{"empty-zero", true, func() { panics.OnEmpty(point{}) }, "value is empty"},
+		{"len", false, func() { panics.OnLenNot("abc", 3) }, ""},
+		{"len-not", true, func() { panics.OnLenNot(map[int]int{1: 1}, 2) }, "len is not 2: len 1"},
+		{"len-none", true, func() { panics.OnLenNot(42, 2) }, "int has no len"},
+		{"nil", false, func() { panics.OnNotNil(nil) }, ""},
+		{"typed-nil", false, func() { panics.OnNotNil(nilptr) }, ""},
+		{"not-nil", true, func() { panics.OnNotNil(&point{}) }, "value is not nil"},
+		{"matching", false, func() { panics.OnNotMatching(`^a+$`, "aaa") }, ""},
+		{"matching-regexp", false, func() { panics.OnNotMatching(regexp.MustCompile(`b`), []byte("abc")) }, ""},
+		{"not-matching", true, func() { panics.OnNotMatching(`^a+$`, "aab", "id") }, `not matching "^a+$": "aab"`},
+		{"bad-pattern", true, func() { panics.OnNotMatching(`(`, "aab") }, "invalid pattern"},
+	}
+	for _, test := range tests {
+		e := recoverFrom(test.fn)
+		switch {
+		case !test.fail && e != nil:
+			t.Errorf("%s: unexpected error: %s", test.name, e)
+		case test.fail && e == nil:
+			t.Errorf("%s: expected error", test.name)
+		case test.fail && !strings.Contains(e.Error(), test.inmsg):
+			t.Errorf("%s: expected %q in error: %s", test.name, test.inmsg, e)
+		}
+	}
+}
+
+func TestValueAssertionsForFunc(t *testing.T) {
+	p := panics.ForFunc("TestValueAssertionsForFunc")
+	e := recoverFrom(func() { p.OnNotEqual("a", "b", "letters") })
+	if e == nil || !strings.HasPrefix(e.Error(), "TestValueAssertionsForFunc(): letters - not equal:") {
+		t.Fatalf("unexpected error: %v", e)
+	}
+	if rp := e.(*panics.Recovered); rp.Kind != panics.KindNotEqual {
+		t.Fatalf("Kind - expected:%s have:%s", panics.KindNotEqual, rp.Kind)
+	}
+}
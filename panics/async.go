@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+)
+
+// -----------------------------------------------------------------------
+// panics.Go
+// -----------------------------------------------------------------------
+
+// Result of a function run per Go() or GoContext(). Exactly one of Value
+// and Err is meaningful: if Err is not nil, Value is the zero value.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Returns the value and error of the result.
+func (r Result[T]) Get() (T, error) {
+	return r.Value, r.Err
+}
+
+// Go runs input arg 'fn' in a new goroutine and delivers its result on
+// the returned channel. A panic in 'fn' is recovered per Recover() and
+// delivered as the result error.
+//
+// Go is the typed analog of the AsyncRecover() idiom:
+//
+//    results := panics.Go(func() (*Config, error) {
+//        data := panics.Must(ioutil.ReadFile(filename))
+//        ...
+//        return config, nil
+//    })
+//    ...
+//    config, e := (<-results).Get()
+//
+// Exactly one result is delivered. The channel is buffered, so the
+// goroutine never blocks if the result is not received.
+func Go[T any](fn func() (T, error)) <-chan Result[T] {
+	results := make(chan Result[T], 1)
+	go func() {
+		results <- runResult(fn)
+	}()
+	return results
+}
+
+// GoContext is the analog of Go() for functions that observe a context.
+// If input arg 'ctx' is done before 'fn' returns, the delivered result
+// error is context.Cause(ctx), and the eventual result of 'fn' is
+// discarded. Timeouts are specified per context.WithTimeout().
+func GoContext[T any](ctx context.Context, fn func(ctx context.Context) (T, error)) <-chan Result[T] {
+	results := make(chan Result[T], 1)
+	done := Go(func() (T, error) {
+		return fn(ctx)
+	})
+	go func() {
+		select {
+		case r := <-done:
+			results <- r
+		case <-ctx.Done():
+			results <- Result[T]{Err: context.Cause(ctx)}
+		}
+	}()
+	return results
+}
+
+// Await receives the result delivered on input arg 'results', or
+// returns context.Cause(ctx) if 'ctx' is done first.
+func Await[T any](ctx context.Context, results <-chan Result[T]) (T, error) {
+	select {
+	case r := <-results:
+		return r.Get()
+	case <-ctx.Done():
+		var zero T
+		return zero, context.Cause(ctx)
+	}
+}
+
+func runResult[T any](fn func() (T, error)) (r Result[T]) {
+	defer func() {
+		if r.Err != nil {
+			var zero T
+			r.Value = zero
+		}
+	}()
+	defer Recover(&r.Err)
+	r.Value, r.Err = fn()
+	return
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"context"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"testing"
+	"time"
+)
+
+func TestGo(t *testing.T) {
+	n, e := (<-panics.Go(func() (int, error) { return 42, nil })).Get()
+	if e != nil || n != 42 {
+		t.Fatalf("Go - expected:(42, nil) have:(%d, %v)", n, e)
+	}
+
+	for _, fn := range errFuncsApi {
+		fn := fn
+		r := <-panics.Go(func() (int, error) {
+			panics.OnError(fn())
+			return 42, nil
+		})
+		if r.Err == nil || r.Value != 0 {
+			t.Fatalf("Go - expected error have:%v", r)
+		}
+	}
+
+	// unreceived results must not block (or leak) the goroutine
+	panics.Go(func() (int, error) { return 0, errors.IllegalState() })
+}
+
+func TestGoContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	results := panics.GoContext(ctx, func(ctx context.Context) (string, error) {
+		time.Sleep(time.Second)
+		return "late", nil
+	})
+	if _, e := (<-results).Get(); e != context.DeadlineExceeded {
+		t.Fatalf("GoContext - expected:%v have:%v", context.DeadlineExceeded, e)
+	}
+
+	results = panics.GoContext(context.Background(), func(ctx context.Context) (string, error) {
+		return "woof", nil
+	})
+	if s, e := panics.Await(context.Background(), results); e != nil || s != "woof" {
+		t.Fatalf("Await - expected:(woof, nil) have:(%s, %v)", s, e)
+	}
+}
+
+func TestAwaitTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	results := panics.Go(func() (int, error) {
+		time.Sleep(100 * time.Millisecond)
+		return 1, nil
+	})
+	if _, e := panics.Await(ctx, results); e != context.DeadlineExceeded {
+		t.Fatalf("Await - expected:%v have:%v", context.DeadlineExceeded, e)
+	}
+}
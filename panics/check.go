@@ -0,0 +1,154 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"github.com/elasticsearch/kriterium/errors"
+	"sync"
+)
+
+// -----------------------------------------------------------------------
+// panics.Check - soft assertions
+// -----------------------------------------------------------------------
+
+// Checker records the failures of soft assertions, i.e. assertions that
+// do not panic. Per Done(), a Checker panics with all failures at once:
+//
+//    func (config *Config) validate() (err error) {
+//        defer panics.Recover(&err)
+//        c := panics.Check()
+//        c.OnNil(config.Store, "store")
+//        c.OnFalse(config.Port > 0, "port")
+//        c.OnNotMatching(`^\w+$`, config.Name, "name")
+//        c.Done()
+//        ...
+//    }
+//
+// The assertion methods are analog to the panics API, e.g. c.OnNil() per
+// panics.OnNil(), and record a *Recovered per failure. A Checker is safe
+// for concurrent use.
+type Checker struct {
+	mu       sync.Mutex
+	failures []error
+}
+
+// Returns a new Checker.
+func Check() *Checker {
+	return &Checker{}
+}
+
+// Returns an errors.Multiple error with all failures recorded so far
+// as its causes, per errors.Join(), or nil if there are none.
+func (c *Checker) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return errors.Join(c.failures...)
+}
+
+// Panics per panics.OnError() with the error returned by Err(), if any.
+func (c *Checker) Done() {
+	OnError(c.Err())
+}
+
+// runs the assertion 'fn' and records its failure, if any.
+func (c *Checker) record(fn func()) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		rp, ok := p.(*Recovered)
+		if !ok {
+			panic(p)
+		}
+		c.mu.Lock()
+		c.failures = append(c.failures, rp)
+		c.mu.Unlock()
+	}()
+	fn()
+}
+
+// See panics.OnError()
+func (c *Checker) OnError(e error, info ...interface{}) {
+	c.record(func() { OnError(e, info...) })
+}
+
+// See panics.OnNil()
+func (c *Checker) OnNil(v interface{}, info ...interface{}) {
+	c.record(func() { OnNil(v, info...) })
+}
+
+// See panics.OnFalse()
+func (c *Checker) OnFalse(flag bool, info ...interface{}) {
+	c.record(func() { OnFalse(flag, info...) })
+}
+
+// See panics.OnTrue()
+func (c *Checker) OnTrue(flag bool, info ...interface{}) {
+	c.record(func() { OnTrue(flag, info...) })
+}
+
+// See panics.OnErrorAs()
+func (c *Checker) OnErrorAs(te errors.TypedError, e error, info ...interface{}) {
+	c.record(func() { OnErrorAs(te, e, info...) })
+}
+
+// See panics.OnNilAs()
+func (c *Checker) OnNilAs(te errors.TypedError, v interface{}, info ...interface{}) {
+	c.record(func() { OnNilAs(te, v, info...) })
+}
+
+// See panics.OnFalseAs()
+func (c *Checker) OnFalseAs(te errors.TypedError, flag bool, info ...interface{}) {
+	c.record(func() { OnFalseAs(te, flag, info...) })
+}
+
+// See panics.OnTrueAs()
+func (c *Checker) OnTrueAs(te errors.TypedError, flag bool, info ...interface{}) {
+	c.record(func() { OnTrueAs(te, flag, info...) })
+}
+
+// See panics.OnNotEqual()
+func (c *Checker) OnNotEqual(want, got interface{}, info ...interface{}) {
+	c.record(func() { OnNotEqual(want, got, info...) })
+}
+
+// See panics.OnOutOfRange()
+func (c *Checker) OnOutOfRange(v, lo, hi interface{}, info ...interface{}) {
+	c.record(func() { OnOutOfRange(v, lo, hi, info...) })
+}
+
+// See panics.OnEmpty()
+func (c *Checker) OnEmpty(v interface{}, info ...interface{}) {
+	c.record(func() { OnEmpty(v, info...) })
+}
+
+// See panics.OnLenNot()
+func (c *Checker) OnLenNot(v interface{}, n int, info ...interface{}) {
+	c.record(func() { OnLenNot(v, n, info...) })
+}
+
+// See panics.OnNotNil()
+func (c *Checker) OnNotNil(v interface{}, info ...interface{}) {
+	c.record(func() { OnNotNil(v, info...) })
+}
+
+// See panics.OnNotMatching()
+func (c *Checker) OnNotMatching(re interface{}, s interface{}, info ...interface{}) {
+	c.record(func() { OnNotMatching(re, s, info...) })
+}
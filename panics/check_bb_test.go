@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"strings"
+	"testing"
+)
+
+func TestCheckerCollectsFailures(t *testing.T) {
+	c := panics.Check()
+	c.OnNil(nil, "store")
+	c.OnFalse(false, "port")
+	c.OnNotEqual(1, 1, "ok")
+	c.OnErrorAs(errors.IllegalArgument, fmt.Errorf("woof"), "name")
+	c.OnNotMatching(`^\w+$`, "a b", "label")
+
+	e := c.Err()
+	if errs := errors.Errors(e); len(errs) != 4 {
+		t.Fatalf("expected 4 failures have:%q", e)
+	}
+	if !errors.Multiple.Matches(e) || !errors.IllegalArgument.Matches(e) {
+		t.Fatalf("unexpected failures:%v", e)
+	}
+	for _, fe := range errors.Errors(e) {
+		rp := fe.(*panics.Recovered)
+		if !strings.Contains(rp.Site.Func, "TestCheckerCollectsFailures") {
+			t.Fatalf("unexpected site:%s", rp.Site)
+		}
+	}
+
+	done := func() (err error) {
+		defer panics.Recover(&err)
+		c.Done()
+		return
+	}
+	if e := done(); !errors.Multiple.Matches(e) || len(errors.Errors(panics.Cause(e))) != 4 {
+		t.Fatalf("Done - expected multiple errors have:%v", e)
+	}
+}
+
+func TestCheckerNoFailures(t *testing.T) {
+	c := panics.Check()
+	c.OnNil(1, "ok")
+	c.OnLenNot([]int{1}, 1, "ok")
+	if e := c.Err(); e != nil {
+		t.Fatalf("Err - unexpected error:%v", e)
+	}
+	c.Done()
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// panics API - context
+// -----------------------------------------------------------------------
+
+// Asserts that input arg 'ctx' is not done, so that long running functions
+// bail out on cancellation:
+//
+//    func index(ctx context.Context, docs []Doc) (err error) {
+//        defer panics.Recover(&err)
+//        for _, doc := range docs {
+//            panics.OnDone(ctx, "index")
+//            ...
+//        }
+//    }
+//
+// If done, panics with a *Recovered with an errors.DeadlineExceeded cause
+// if the deadline of 'ctx' expired, or an errors.Canceled cause if not,
+// with descriptive message based on the 'info' n-aray input arg. The
+// cause in turn has context.Cause(ctx) as its cause.
+func OnDone(ctx context.Context, info ...interface{}) {
+	select {
+	case <-ctx.Done():
+	default:
+		return
+	}
+	cause := doneError(ctx, fmt.Sprintf("%s - context done:", fmtInfo(info...)))
+	raise(KindDone, cause, cause.Error(), info)
+}
+
+// Runs input arg 'fn' with a context derived from 'ctx' with timeout 'd',
+// and returns its error. A panic in 'fn' is recovered per Recover(). If
+// 'ctx' is done or the timeout expires before 'fn' returns, returns an
+// errors.DeadlineExceeded or errors.Canceled error, per OnDone(), without
+// waiting for 'fn', which should observe its context:
+//
+//    e := panics.Within(ctx, time.Second, func(ctx context.Context) error {
+//        return ping(ctx, host)
+//    })
+//    if errors.DeadlineExceeded.Matches(e) {
+//        ...
+//    }
+func Within(ctx context.Context, d time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	results := Go(func() (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	select {
+	case r := <-results:
+		return r.Err
+	case <-ctx.Done():
+		return doneError(ctx, fmt.Sprintf("Within %s:", d))
+	}
+}
+
+// Returns the typed error for the done context 'ctx'.
+func doneError(ctx context.Context, msg string) error {
+	return doneType(ctx)(msg, context.Cause(ctx))
+}
+
+// Returns errors.DeadlineExceeded or errors.Canceled, per the done context
+// 'ctx'.
+func doneType(ctx context.Context) errors.TypedError {
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.DeadlineExceeded
+	}
+	return errors.Canceled
+}
@@ -0,0 +1,91 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"testing"
+	"time"
+)
+
+func onDone(ctx context.Context) (err error) {
+	defer panics.Recover(&err)
+	panics.OnDone(ctx, "work")
+	return
+}
+
+func TestOnDone(t *testing.T) {
+	if e := onDone(context.Background()); e != nil {
+		t.Fatalf("unexpected error:%v", e)
+	}
+
+	cause := fmt.Errorf("shutdown")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(cause)
+	e := onDone(ctx)
+	if !errors.Canceled.Matches(e) || errors.RootCause(e) != cause {
+		t.Fatalf("expected canceled error with cause - have:\n%s", errors.FormatChain(e, false))
+	}
+	if rp := e.(*panics.Recovered); rp.Kind != panics.KindDone {
+		t.Fatalf("expected kind OnDone - have:%s", rp.Kind)
+	}
+
+	ctx, cancel2 := context.WithDeadline(context.Background(), time.Now())
+	defer cancel2()
+	if e := onDone(ctx); !errors.DeadlineExceeded.Matches(e) || errors.RootCause(e) != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded error - have:%v", e)
+	}
+}
+
+func TestWithin(t *testing.T) {
+	ctx := context.Background()
+	if e := panics.Within(ctx, time.Second, func(ctx context.Context) error { return nil }); e != nil {
+		t.Fatalf("unexpected error:%v", e)
+	}
+
+	e := panics.Within(ctx, time.Second, func(ctx context.Context) error {
+		panics.OnNilAs(errors.IllegalArgument, nil, "arg")
+		return nil
+	})
+	if !errors.IllegalArgument.Matches(e) {
+		t.Fatalf("expected recovered panic - have:%v", e)
+	}
+
+	e = panics.Within(ctx, 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if !errors.DeadlineExceeded.Matches(e) {
+		t.Fatalf("expected deadline exceeded - have:%v", e)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	e = panics.Within(canceled, time.Second, func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if !errors.Canceled.Matches(e) {
+		t.Fatalf("expected canceled - have:%v", e)
+	}
+}
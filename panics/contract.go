@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"sync"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------
+// panics API - contracts
+// -----------------------------------------------------------------------
+
+// Contracts are assertions on the interface of a function or type, per
+// design-by-contract. A violated contract panics with a *Recovered with
+// an errors.Precondition, errors.Postcondition or errors.Invariant cause:
+//
+//    func (s *Stack) Pop() (top int) {
+//        panics.Require(s.Len() > 0, "Pop: empty stack")
+//        defer panics.Guard(s)()
+//        defer panics.Ensure(func() bool { return s.Len() >= 0 }, "Pop: len")
+//        ...
+//    }
+//
+// Contract checks are enabled by default, and are toggled per process
+// (see SetContracts()) or per package (see SetPackageContracts()). A
+// disabled check does not panic, but the arguments of Require() are still
+// evaluated by the caller. The conditions of RequireFunc(), Ensure() and
+// Guard() are not evaluated if disabled.
+
+// Invariant is implemented by types with invariants, checked per Guard().
+type Invariant interface {
+	// Returns a non-nil error if the invariant does not hold.
+	CheckInvariant() error
+}
+
+// Asserts the precondition 'cond'. If false, panics with a *Recovered
+// with an errors.Precondition cause with descriptive message based on the
+// 'info' n-aray input arg.
+func Require(cond bool, info ...interface{}) {
+	if cond || !contractsEnabled() {
+		return
+	}
+	raiseAs(errors.Precondition, KindRequire, fmt.Sprintf("%s - precondition failed:", fmtInfo(info...)), info)
+}
+
+// See Require(). Asserts the precondition 'cond', which is evaluated only
+// if contract checks are enabled, e.g. for costly conditions:
+//
+//    panics.RequireFunc(func() bool { return sort.IntsAreSorted(xs) }, "search: unsorted")
+func RequireFunc(cond func() bool, info ...interface{}) {
+	if !contractsEnabled() || cond() {
+		return
+	}
+	raiseAs(errors.Precondition, KindRequire, fmt.Sprintf("%s - precondition failed:", fmtInfo(info...)), info)
+}
+
+// Asserts the postcondition 'cond' on return of the calling function.
+// Invocation of Ensure() /must/ be deferred, so that 'cond' may inspect
+// named results:
+//
+//    func sqrt(x float64) (r float64) {
+//        defer panics.Ensure(func() bool { return math.Abs(r*r-x) < 1e-9 }, "sqrt")
+//        ...
+//    }
+//
+// If 'cond' returns false, panics with a *Recovered with an
+// errors.Postcondition cause with descriptive message based on the 'info'
+// n-aray input arg. Postconditions are not checked if the calling
+// function panics: the panic propagates as is.
+func Ensure(cond func() bool, info ...interface{}) {
+	if p := recover(); p != nil {
+		panic(p)
+	}
+	if !contractsEnabled() || cond() {
+		return
+	}
+	raiseAs(errors.Postcondition, KindEnsure, fmt.Sprintf("%s - postcondition failed:", fmtInfo(info...)), info)
+}
+
+// Asserts the invariant of 'v' on entry of the calling (method) function,
+// and returns a function that asserts it on exit. The returned function
+// /must/ be deferred:
+//
+//    func (s *Stack) Push(x int) {
+//        defer panics.Guard(s)()
+//        ...
+//    }
+//
+// If the invariant does not hold, panics with a *Recovered with an
+// errors.Invariant cause, which in turn has the CheckInvariant() error as
+// cause, with descriptive message based on the 'info' n-aray input arg.
+// The invariant is not checked on exit if the calling function panics.
+func Guard(v Invariant, info ...interface{}) func() {
+	if !contractsEnabled() {
+		return func() {}
+	}
+	checkInvariant(v, "on entry", info)
+	return func() {
+		if p := recover(); p != nil {
+			panic(p)
+		}
+		checkInvariant(v, "on exit", info)
+	}
+}
+
+func checkInvariant(v Invariant, when string, info []interface{}) {
+	e := v.CheckInvariant()
+	if e == nil {
+		return
+	}
+	cause := errors.Invariant(fmt.Sprintf("%s - invariant failed %s:", fmtInfo(info...), when), e)
+	raise(KindInvariant, cause, cause.Error(), info)
+}
+
+// -----------------------------------------------------------------------
+// contract toggles
+// -----------------------------------------------------------------------
+
+var (
+	// process wide toggle: 0 is enabled
+	contractsOff uint32
+	// package toggles - copy on write
+	pkgContracts   atomic.Value
+	pkgContractsMu sync.Mutex
+)
+
+func init() {
+	pkgContracts.Store(map[string]bool{})
+}
+
+// Enables or disables contract checks process wide.
+func SetContracts(enabled bool) {
+	var off uint32
+	if !enabled {
+		off = 1
+	}
+	atomic.StoreUint32(&contractsOff, off)
+}
+
+// Enables or disables contract checks of the package with (import) path
+// 'pkg', regardless of the process wide setting.
+func SetPackageContracts(pkg string, enabled bool) {
+	pkgContractsMu.Lock()
+	defer pkgContractsMu.Unlock()
+	current := pkgContracts.Load().(map[string]bool)
+	toggles := make(map[string]bool, len(current)+1)
+	for k, v := range current {
+		toggles[k] = v
+	}
+	toggles[pkg] = enabled
+	pkgContracts.Store(toggles)
+}
+
+// Removes the contract checks toggle of the package with (import) path
+// 'pkg', if any.
+func ClearPackageContracts(pkg string) {
+	pkgContractsMu.Lock()
+	defer pkgContractsMu.Unlock()
+	current := pkgContracts.Load().(map[string]bool)
+	toggles := make(map[string]bool, len(current))
+	for k, v := range current {
+		if k != pkg {
+			toggles[k] = v
+		}
+	}
+	pkgContracts.Store(toggles)
+}
+
+// Returns true if contract checks are enabled for the caller of the
+// panics API.
+func contractsEnabled() bool {
+	if toggles := pkgContracts.Load().(map[string]bool); len(toggles) > 0 {
+		if enabled, ok := toggles[funcPackage(callSite().Func)]; ok {
+			return enabled
+		}
+	}
+	return atomic.LoadUint32(&contractsOff) == 0
+}
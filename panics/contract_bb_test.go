@@ -0,0 +1,141 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"testing"
+)
+
+// a stack of non-negative ints
+type stack struct {
+	items []int
+}
+
+func (s *stack) CheckInvariant() error {
+	for _, x := range s.items {
+		if x < 0 {
+			return fmt.Errorf("negative item %d", x)
+		}
+	}
+	return nil
+}
+
+func (s *stack) push(x int) (err error) {
+	defer panics.Recover(&err)
+	defer panics.Guard(s, "push")()
+	s.items = append(s.items, x)
+	return
+}
+
+func (s *stack) pop(bug bool) (top int, err error) {
+	defer panics.Recover(&err)
+	panics.Require(len(s.items) > 0, "pop: empty stack")
+	n := len(s.items)
+	defer panics.Ensure(func() bool { return len(s.items) == n-1 }, "pop: len")
+	top = s.items[n-1]
+	if !bug {
+		s.items = s.items[:n-1]
+	}
+	return
+}
+
+func TestContracts(t *testing.T) {
+	var s stack
+	if _, e := s.pop(false); !errors.Precondition.Matches(e) {
+		t.Fatalf("expected precondition violation - have:%v", e)
+	}
+	if e := s.push(1); e != nil {
+		t.Fatalf("push - unexpected error: %s", e)
+	}
+	if _, e := s.pop(true); !errors.Postcondition.Matches(e) {
+		t.Fatalf("expected postcondition violation - have:%v", e)
+	}
+	if top, e := s.pop(false); e != nil || top != 1 {
+		t.Fatalf("pop - expected:(1, nil) have:(%d, %v)", top, e)
+	}
+
+	e := s.push(-1)
+	if !errors.Invariant.Matches(e) {
+		t.Fatalf("expected invariant violation - have:%v", e)
+	}
+	if rp := e.(*panics.Recovered); rp.Kind != panics.KindInvariant {
+		t.Fatalf("expected kind Invariant - have:%s", rp.Kind)
+	}
+	if e := s.push(2); !errors.Invariant.Matches(e) {
+		t.Fatalf("expected invariant violation on entry - have:%v", e)
+	}
+}
+
+func TestEnsureOnPanic(t *testing.T) {
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		defer panics.Ensure(func() bool { return false }, "not checked")
+		panics.OnNilAs(errors.IllegalArgument, nil, "arg")
+		return
+	}
+	if e := fn(); !errors.IllegalArgument.Matches(e) {
+		t.Fatalf("expected original panic - have:%v", e)
+	}
+}
+
+func TestContractToggles(t *testing.T) {
+	var s stack
+	panics.SetContracts(false)
+	defer panics.SetContracts(true)
+	if _, e := s.pop(false); !errors.Runtime.Matches(e) {
+		t.Fatalf("expected unchecked precondition - have:%v", e)
+	}
+
+	panics.SetPackageContracts(testpkg, true)
+	defer panics.ClearPackageContracts(testpkg)
+	if _, e := s.pop(false); !errors.Precondition.Matches(e) {
+		t.Fatalf("expected package precondition check - have:%v", e)
+	}
+
+	panics.SetContracts(true)
+	panics.SetPackageContracts(testpkg, false)
+	if e := s.push(-1); e != nil {
+		t.Fatalf("expected unchecked invariant - have:%v", e)
+	}
+}
+
+func TestRequireFunc(t *testing.T) {
+	evaluated := false
+	cond := func() bool {
+		evaluated = true
+		return false
+	}
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		panics.RequireFunc(cond, "costly")
+		return
+	}
+	if e := fn(); !errors.Precondition.Matches(e) || !evaluated {
+		t.Fatalf("expected precondition violation - have:%v", e)
+	}
+
+	evaluated = false
+	panics.SetContracts(false)
+	defer panics.SetContracts(true)
+	if e := fn(); e != nil || evaluated {
+		t.Fatalf("expected unevaluated precondition - have:(%v, %t)", e, evaluated)
+	}
+}
@@ -0,0 +1,394 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// crash reports
+// -----------------------------------------------------------------------
+
+// Crash report file formats.
+type ReportFormat int
+
+const (
+	ReportJSON ReportFormat = iota
+	ReportText
+)
+
+// CrashReporter writes crash report files for recovered panics. Crash
+// reporting is opt-in, per EnableCrashReports():
+//
+//    func main() {
+//        defer panics.ExitHandler("my-command")
+//        panics.EnableCrashReports(&panics.CrashReporter{
+//            Dir:  filepath.Join(os.TempDir(), "my-command"),
+//            Keep: 5,
+//        })
+//        ...
+//    }
+//
+// A report includes the error (cause) chain, the recovered panic value,
+// the stacks of all goroutines, build info per debug.ReadBuildInfo(), the
+// command line args with secrets redacted, and a summary of the process
+// environment.
+//
+// By default, reports are written for ExitHandler() exits and for
+// recovered panics not raised via the panics API (i.e. of KindPanic or
+// KindRuntime), so that pseudo-exceptions such as OnError() do not
+// rotate out the reports that matter. See CrashReporter.Filter.
+type CrashReporter struct {
+	// Directory of the report files. Created if it does not exist.
+	// Defaults to the kriterium-crash directory in os.TempDir().
+	Dir string
+	// Report file format. Defaults to ReportJSON.
+	Format ReportFormat
+	// Max number of report files retained in Dir. Older reports are
+	// removed. Defaults to 10.
+	Keep int
+	// Additional (case insensitive) name fragments of command line flags
+	// with secret values. See Redact().
+	Secrets []string
+	// Called with the recovery function (e.g. "Recover") and the recovered
+	// panic, if not nil, to select the panics to report in lieu of the
+	// default selection.
+	Filter func(op string, rp *Recovered) bool
+
+	mu sync.Mutex // serializes report writes
+}
+
+// the active crash reporter, if any.
+var crashReporter atomic.Pointer[CrashReporter]
+
+// Installs the input arg 'r' as the active crash reporter. A nil 'r'
+// disables crash reporting.
+func EnableCrashReports(r *CrashReporter) {
+	crashReporter.Store(r)
+}
+
+// crash report file name prefix
+const crashFilePrefix = "kriterium-crash-"
+
+// crash report file names, per Write(). Only files with matching names
+// are rotated.
+var crashFileName = regexp.MustCompile(`^kriterium-crash-\d{8}T\d{6}\.\d{9}Z-\d+\.(json|txt)$`)
+
+// default crash report directory
+var defaultCrashDir = filepath.Join(os.TempDir(), "kriterium-crash")
+
+// reports the recovered panic per the active crash reporter, if any.
+func reportCrash(op, label string, rp *Recovered) {
+	r := crashReporter.Load()
+	if r == nil || !r.reports(op, rp) {
+		return
+	}
+	if _, e := r.Write(op, label, rp); e != nil {
+		log.Printf("panics: crash report: %s", e)
+	}
+}
+
+// returns true if the recovered panic 'rp' is to be reported.
+func (r *CrashReporter) reports(op string, rp *Recovered) bool {
+	if r.Filter != nil {
+		return r.Filter(op, rp)
+	}
+	return op == "ExitHandler" || rp.Kind == KindPanic || rp.Kind == KindRuntime
+}
+
+// Writes a crash report for the recovered panic 'rp', recovered by the
+// panics recovery function 'op' (e.g. "ExitHandler"). Input arg 'label'
+// is informational. Returns the path of the report file.
+func (r *CrashReporter) Write(op, label string, rp *Recovered) (string, error) {
+	report := newCrashReport(op, label, rp, r.Secrets)
+
+	var data []byte
+	var ext string
+	switch r.Format {
+	case ReportText:
+		data, ext = report.text(), ".txt"
+	default:
+		var e error
+		if data, e = json.MarshalIndent(report, "", "  "); e != nil {
+			return "", e
+		}
+		ext = ".json"
+	}
+
+	dir := r.Dir
+	if dir == "" {
+		dir = defaultCrashDir
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if e := os.MkdirAll(dir, 0700); e != nil {
+		return "", e
+	}
+	fname := fmt.Sprintf("%s%s-%d%s", crashFilePrefix, report.Time.UTC().Format("20060102T150405.000000000Z"), report.Env.PID, ext)
+	path := filepath.Join(dir, fname)
+	if e := ioutil.WriteFile(path, data, 0600); e != nil {
+		return "", e
+	}
+	return path, r.rotate(dir)
+}
+
+// removes all but the newest Keep reports in 'dir'.
+func (r *CrashReporter) rotate(dir string) error {
+	keep := r.Keep
+	if keep <= 0 {
+		keep = 10
+	}
+	entries, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return e
+	}
+	var reports []string
+	for _, entry := range entries {
+		if !entry.IsDir() && crashFileName.MatchString(entry.Name()) {
+			reports = append(reports, entry.Name())
+		}
+	}
+	// file names are timestamped and sort chronologically
+	sort.Strings(reports)
+	for len(reports) > keep {
+		if e := os.Remove(filepath.Join(dir, reports[0])); e != nil && !os.IsNotExist(e) {
+			return e
+		}
+		reports = reports[1:]
+	}
+	return nil
+}
+
+// crash report content
+type crashReport struct {
+	Time       time.Time  `json:"time"`
+	Op         string     `json:"op"`
+	Label      string     `json:"label,omitempty"`
+	Error      string     `json:"error"`
+	Chain      []string   `json:"chain"`
+	Kind       string     `json:"kind"`
+	Site       string     `json:"site"`
+	Panic      string     `json:"panic"`
+	Stack      string     `json:"stack"`
+	Goroutines string     `json:"goroutines"`
+	Build      *buildInfo `json:"build,omitempty"`
+	Args       []string   `json:"args"`
+	Env        envSummary `json:"env"`
+}
+
+type buildInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path"`
+	Version   string            `json:"version"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+type envSummary struct {
+	PID          int      `json:"pid"`
+	Hostname     string   `json:"hostname"`
+	Executable   string   `json:"executable"`
+	Dir          string   `json:"dir"`
+	GOOS         string   `json:"goos"`
+	GOARCH       string   `json:"goarch"`
+	NumCPU       int      `json:"num_cpu"`
+	GOMAXPROCS   int      `json:"gomaxprocs"`
+	NumGoroutine int      `json:"num_goroutine"`
+	Vars         []string `json:"vars"` // names only
+}
+
+func newCrashReport(op, label string, rp *Recovered, secrets []string) *crashReport {
+	report := &crashReport{
+		Time:       time.Now(),
+		Op:         op,
+		Label:      label,
+		Error:      rp.Error(),
+		Kind:       rp.Kind.String(),
+		Site:       rp.Site.String(),
+		Panic:      fmt.Sprintf("%#v", rp.Value),
+		Stack:      string(rp.Stack()),
+		Goroutines: string(allStacks()),
+		Args:       Redact(os.Args, secrets...),
+	}
+	if rp.Value == nil {
+		report.Panic = fmt.Sprintf("%s: %s", rp.Kind, rp.Error())
+	}
+	for _, e := range errors.Chain(rp) {
+		report.Chain = append(report.Chain, e.Error())
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		report.Build = &buildInfo{
+			GoVersion: bi.GoVersion,
+			Path:      bi.Path,
+			Version:   bi.Main.Version,
+			Settings:  make(map[string]string),
+		}
+		for _, setting := range bi.Settings {
+			report.Build.Settings[setting.Key] = setting.Value
+		}
+	}
+
+	env := &report.Env
+	env.PID = os.Getpid()
+	env.Hostname, _ = os.Hostname()
+	env.Executable, _ = os.Executable()
+	env.Dir, _ = os.Getwd()
+	env.GOOS, env.GOARCH = runtime.GOOS, runtime.GOARCH
+	env.NumCPU, env.GOMAXPROCS = runtime.NumCPU(), runtime.GOMAXPROCS(0)
+	env.NumGoroutine = runtime.NumGoroutine()
+	for _, kv := range os.Environ() {
+		env.Vars = append(env.Vars, strings.SplitN(kv, "=", 2)[0])
+	}
+	sort.Strings(env.Vars)
+	return report
+}
+
+func (report *crashReport) text() []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "crash report - %s\n\n", report.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&buf, "op:     %s %s\n", report.Op, report.Label)
+	fmt.Fprintf(&buf, "kind:   %s\n", report.Kind)
+	fmt.Fprintf(&buf, "site:   %s\n", report.Site)
+	fmt.Fprintf(&buf, "panic:  %s\n", report.Panic)
+	fmt.Fprintf(&buf, "error:  %s\n", report.Error)
+	for _, e := range report.Chain[1:] {
+		fmt.Fprintf(&buf, "  caused by: %s\n", e)
+	}
+	fmt.Fprintf(&buf, "\nargs:   %q\n", report.Args)
+	if b := report.Build; b != nil {
+		fmt.Fprintf(&buf, "\nbuild:  %s %s (%s)\n", b.Path, b.Version, b.GoVersion)
+		keys := make([]string, 0, len(b.Settings))
+		for k := range b.Settings {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&buf, "  %s=%s\n", k, b.Settings[k])
+		}
+	}
+	env := report.Env
+	fmt.Fprintf(&buf, "\nenv:    pid %d host %s exe %s dir %s\n", env.PID, env.Hostname, env.Executable, env.Dir)
+	fmt.Fprintf(&buf, "        %s/%s cpu %d gomaxprocs %d goroutines %d\n", env.GOOS, env.GOARCH, env.NumCPU, env.GOMAXPROCS, env.NumGoroutine)
+	fmt.Fprintf(&buf, "        vars %s\n", strings.Join(env.Vars, " "))
+	fmt.Fprintf(&buf, "\nstack:\n%s\n", report.Stack)
+	fmt.Fprintf(&buf, "\ngoroutines:\n%s\n", report.Goroutines)
+	return buf.Bytes()
+}
+
+// Returns the stacks of all goroutines, per runtime.Stack().
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// -----------------------------------------------------------------------
+// redaction
+// -----------------------------------------------------------------------
+
+// (lower case) name fragments of flags with secret values.
+var secretNames = []string{"password", "passwd", "secret", "token", "apikey", "api-key", "api_key", "credential", "auth", "private-key"}
+
+const redacted = "<redacted>"
+
+// Returns a copy of the command line 'args' with secret values redacted.
+// The value of a flag (e.g. -password=x, --token x) is secret if the flag
+// name includes any of the (case insensitive) fragments: password, passwd,
+// secret, token, apikey, api-key, api_key, credential, auth, private-key,
+// or any of the input arg 'secrets'. Passwords in URLs are redacted as well.
+func Redact(args []string, secrets ...string) []string {
+	redactedArgs := make([]string, len(args))
+	redactNext := false
+	for i, arg := range args {
+		secretValue := redactNext
+		redactNext = false
+		switch {
+		case len(arg) > 1 && strings.HasPrefix(arg, "-"):
+			name := strings.TrimLeft(arg, "-")
+			j := strings.Index(name, "=")
+			if j < 0 {
+				redactNext = isSecret(name, secrets)
+				break
+			}
+			flag, value := arg[:len(arg)-len(name)+j+1], name[j+1:]
+			if isSecret(name[:j], secrets) {
+				arg = flag + redacted
+			} else {
+				arg = flag + redactURL(value)
+			}
+		case secretValue:
+			arg = redacted
+		default:
+			arg = redactURL(arg)
+		}
+		redactedArgs[i] = arg
+	}
+	return redactedArgs
+}
+
+func isSecret(name string, secrets []string) bool {
+	name = strings.ToLower(name)
+	for _, fragment := range secretNames {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+	for _, fragment := range secrets {
+		if strings.Contains(name, strings.ToLower(fragment)) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURL(arg string) string {
+	if !strings.Contains(arg, "://") || !strings.Contains(arg, "@") {
+		return arg
+	}
+	u, e := url.Parse(arg)
+	if e != nil || u.User == nil {
+		return arg
+	}
+	if _, ok := u.User.Password(); !ok {
+		return arg
+	}
+	u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	return u.String()
+}
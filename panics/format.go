@@ -0,0 +1,253 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// -----------------------------------------------------------------------
+// info formatting
+// -----------------------------------------------------------------------
+
+// Formatter formats the 'info' n-ary input args of the panics API into
+// the descriptive messages of raised errors. See SetFormatter().
+//
+// Info args may include key/value pairs, per KV:
+//
+//    panics.OnFalse(n <= max, "batch too large", panics.Pair("n", n), panics.Pair("max", max))
+type Formatter interface {
+	Format(info []interface{}) string
+}
+
+// KV is a key/value pair info arg.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// Returns a KV info arg.
+func Pair(key string, value interface{}) KV {
+	return KV{key, value}
+}
+
+// TextFormatter formats info args as space separated text, and KV args
+// as key=value, e.g.:
+//
+//    batch too large n=120 max=100
+//
+// This is the default Formatter.
+type TextFormatter struct {
+	// Max length of a formatted value, in bytes. Longer values are
+	// truncated. Zero for no limit.
+	MaxLen int
+}
+
+// LogfmtFormatter formats info args per logfmt, with all args that are
+// not a KV joined as the "msg" value, e.g.:
+//
+//    msg="batch too large" n=120 max=100
+type LogfmtFormatter struct {
+	// See TextFormatter.MaxLen.
+	MaxLen int
+}
+
+// JSONFormatter formats info args as a JSON object, with all args that
+// are not a KV joined as the "msg" value, e.g.:
+//
+//    {"msg":"batch too large","n":120,"max":100}
+type JSONFormatter struct {
+	// See TextFormatter.MaxLen.
+	MaxLen int
+}
+
+// the Formatter in effect. atomic.Value requires a consistent type.
+type formatterHolder struct {
+	Formatter
+}
+
+var formatter atomic.Value
+
+func init() {
+	formatter.Store(formatterHolder{TextFormatter{}})
+}
+
+// Sets the Formatter of info args. A nil 'f' restores the default
+// TextFormatter.
+func SetFormatter(f Formatter) {
+	if f == nil {
+		f = TextFormatter{}
+	}
+	formatter.Store(formatterHolder{f})
+}
+
+// Returns the Formatter in effect.
+func GetFormatter() Formatter {
+	return formatter.Load().(formatterHolder).Formatter
+}
+
+func (f TextFormatter) Format(info []interface{}) string {
+	parts := make([]string, len(info))
+	for i, arg := range info {
+		if kv, ok := arg.(KV); ok {
+			parts[i] = kv.Key + "=" + formatValue(kv.Value, f.MaxLen)
+		} else {
+			parts[i] = formatValue(arg, f.MaxLen)
+		}
+	}
+	return strings.Trim(strings.Join(parts, " "), " ")
+}
+
+func (f LogfmtFormatter) Format(info []interface{}) string {
+	msg, pairs := splitInfo(info, f.MaxLen)
+	var parts []string
+	if msg != "" {
+		parts = append(parts, "msg="+logfmtQuote(msg))
+	}
+	for _, kv := range pairs {
+		parts = append(parts, kv.Key+"="+logfmtQuote(formatValue(kv.Value, f.MaxLen)))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f JSONFormatter) Format(info []interface{}) string {
+	msg, pairs := splitInfo(info, f.MaxLen)
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if msg != "" {
+		writeJSONField(&buf, "msg", msg)
+	}
+	for _, kv := range pairs {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		var value interface{} = formatValue(kv.Value, f.MaxLen)
+		if isJSONScalar(kv.Value) {
+			value = kv.Value
+		}
+		writeJSONField(&buf, kv.Key, value)
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// splits info args into the text of all non KV args and the KV args.
+func splitInfo(info []interface{}, maxLen int) (string, []KV) {
+	var text []interface{}
+	var pairs []KV
+	for _, arg := range info {
+		if kv, ok := arg.(KV); ok {
+			pairs = append(pairs, kv)
+		} else {
+			text = append(text, arg)
+		}
+	}
+	return TextFormatter{maxLen}.Format(text), pairs
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}) {
+	k, _ := json.Marshal(key)
+	v, e := json.Marshal(value)
+	if e != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(v)
+}
+
+// Returns true for bool and number values, which JSONFormatter formats
+// per JSON.
+func isJSONScalar(v interface{}) bool {
+	if v == nil {
+		return false
+	}
+	switch reflect.TypeOf(v).Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		_, isDuration := v.(time.Duration)
+		return !isDuration
+	}
+	return false
+}
+
+func logfmtQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"") || strings.IndexFunc(s, unicode.IsControl) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// formats an info arg value, truncated to 'maxLen' bytes if > 0.
+func formatValue(v interface{}, maxLen int) string {
+	var str string
+	switch t := v.(type) {
+	case string:
+		str = t
+	case error:
+		str = t.Error()
+	case time.Duration:
+		str = t.String()
+	case []byte:
+		if utf8.Valid(t) && bytes.IndexFunc(t, func(r rune) bool { return !unicode.IsPrint(r) && !unicode.IsSpace(r) }) < 0 {
+			str = string(t)
+		} else {
+			str = fmt.Sprintf("0x%x", t)
+		}
+	case stringCodec: // incl. time.Time
+		str = t.String()
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		str = fmt.Sprintf("%d", t)
+	case bool:
+		str = fmt.Sprintf("%t", t)
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() == reflect.Struct {
+			str = fmt.Sprintf("%+v", v)
+		} else {
+			str = fmt.Sprintf("%v", v)
+		}
+	}
+	return truncate(str, maxLen)
+}
+
+// truncates 's' to 'maxLen' bytes (at a rune boundary) if > 0.
+func truncate(s string, maxLen int) string {
+	if maxLen <= 0 || len(s) <= maxLen {
+		return s
+	}
+	cut := maxLen
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(%d more bytes)", s[:cut], len(s)-cut)
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/elasticsearch/kriterium/panics"
+	"strings"
+	"testing"
+	"time"
+)
+
+var formatInfo = []interface{}{
+	"batch too large",
+	panics.Pair("n", 120),
+	panics.Pair("took", 1500*time.Millisecond),
+	panics.Pair("data", []byte{0xff, 0x01}),
+	panics.Pair("cause", fmt.Errorf("io error")),
+	panics.Pair("at", point{X: 1, Y: 2}),
+}
+
+func TestTextFormatter(t *testing.T) {
+	have := panics.TextFormatter{}.Format(formatInfo)
+	expected := `batch too large n=120 took=1.5s data=0xff01 cause=io error at={X:1 Y:2 tags:[]}`
+	if have != expected {
+		t.Fatalf("expected:%q have:%q", expected, have)
+	}
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	have = panics.TextFormatter{}.Format([]interface{}{"at", at})
+	if expected := "at 2020-01-02 03:04:05 +0000 UTC"; have != expected {
+		t.Fatalf("expected:%q have:%q", expected, have)
+	}
+
+	have = panics.TextFormatter{MaxLen: 5}.Format([]interface{}{"truncated value", []byte("text")})
+	if expected := "trunc...(10 more bytes) text"; have != expected {
+		t.Fatalf("expected:%q have:%q", expected, have)
+	}
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	have := panics.LogfmtFormatter{}.Format(formatInfo)
+	expected := `msg="batch too large" n=120 took=1.5s data=0xff01 cause="io error" at="{X:1 Y:2 tags:[]}"`
+	if have != expected {
+		t.Fatalf("expected:%q have:%q", expected, have)
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	have := panics.JSONFormatter{}.Format(formatInfo)
+	var fields map[string]interface{}
+	if e := json.Unmarshal([]byte(have), &fields); e != nil {
+		t.Fatalf("invalid json %q: %s", have, e)
+	}
+	if fields["msg"] != "batch too large" || fields["n"] != float64(120) || fields["took"] != "1.5s" {
+		t.Fatalf("unexpected fields: %s", have)
+	}
+}
+
+func TestSetFormatter(t *testing.T) {
+	panics.SetFormatter(panics.LogfmtFormatter{})
+	defer panics.SetFormatter(nil)
+
+	e := recoverFrom(func() {
+		panics.OnFalse(false, "limit", panics.Pair("n", 3))
+	})
+	if !strings.Contains(e.Error(), `msg=limit n=3`) {
+		t.Fatalf("expected logfmt info have:%q", e)
+	}
+}
@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+	"github.com/elasticsearch/kriterium/errors"
+	"sync"
+)
+
+// -----------------------------------------------------------------------
+// panics.Group
+// -----------------------------------------------------------------------
+
+// Group runs functions concurrently, with panics recovered per Recover().
+// It is the panic-safe analog of errgroup.Group.
+//
+//    g, ctx := panics.NewGroup(context.Background(), true)
+//    g.SetLimit(4)
+//    for _, file := range files {
+//        file := file
+//        g.Go(func() error {
+//            panics.OnError(index(ctx, file))
+//            return nil
+//        })
+//    }
+//    if e := g.Wait(); e != nil {
+//        ...
+//    }
+//
+// A zero Group is valid: it has no limit, does not cancel on error, and
+// Wait() returns all errors.
+type Group struct {
+	cancel        context.CancelFunc
+	cancelOnError bool
+	sem           chan struct{}
+	wg            sync.WaitGroup
+	mu            sync.Mutex
+	errs          []error
+}
+
+// Returns a new Group and a derived context that is canceled when Wait()
+// returns. If input arg 'cancelOnError' is true, the derived context is
+// also canceled on the first failure of any function of the group, and
+// Wait() returns that first error. Otherwise Wait() returns all errors,
+// per errors.Join().
+func NewGroup(ctx context.Context, cancelOnError bool) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel, cancelOnError: cancelOnError}, ctx
+}
+
+// Limits the number of concurrently running functions to 'n'. A value of
+// n <= 0 removes the limit.
+//
+// SetLimit must not be called while any functions of the group are
+// running.
+func (g *Group) SetLimit(n int) {
+	if n <= 0 {
+		g.sem = nil
+		return
+	}
+	g.sem = make(chan struct{}, n)
+}
+
+// Runs input arg 'fn' in a new goroutine. If a limit is set, Go blocks
+// until 'fn' can be run within the limit. A panic in 'fn' is recovered
+// and considered a failure, just as a returned error.
+func (g *Group) Go(fn func() error) {
+	if g.sem != nil {
+		g.sem <- struct{}{}
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+		if e := runGrouped(fn); e != nil {
+			g.fail(e)
+		}
+	}()
+}
+
+// Waits for all functions of the group to return, and then returns the
+// first error (if canceling on error) or all errors joined per
+// errors.Join(). Returns nil if there were no failures.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	if g.cancel != nil {
+		g.cancel()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) == 0 {
+		return nil
+	}
+	if g.cancelOnError {
+		return g.errs[0]
+	}
+	return errors.Join(g.errs...)
+}
+
+func runGrouped(fn func() error) (err error) {
+	defer Recover(&err)
+	return fn()
+}
+
+func (g *Group) fail(e error) {
+	g.mu.Lock()
+	g.errs = append(g.errs, e)
+	g.mu.Unlock()
+	if g.cancelOnError && g.cancel != nil {
+		g.cancel()
+	}
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGroupCollectsAllErrors(t *testing.T) {
+	g, _ := panics.NewGroup(context.Background(), false)
+	for _, fn := range errFuncsApi {
+		fn := fn
+		g.Go(func() error {
+			panics.OnError(fn())
+			return nil
+		})
+	}
+	g.Go(okFunc)
+	g.Go(func() error { return fmt.Errorf("returned error") })
+
+	e := g.Wait()
+	if errs := errors.Errors(e); len(errs) != len(errFuncsApi)+1 {
+		t.Fatalf("Wait - expected %d errors have:%q", len(errFuncsApi)+1, e)
+	}
+	if !errors.Multiple.Matches(e) {
+		t.Fatalf("Wait - expected multiple errors have:%q", e)
+	}
+}
+
+func TestGroupCancelOnError(t *testing.T) {
+	g, ctx := panics.NewGroup(context.Background(), true)
+	g.Go(func() error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.Go(func() error {
+		panics.OnFalseAs(errors.IllegalState, false, "first")
+		return nil
+	})
+
+	e := g.Wait()
+	if !errors.IllegalState.Matches(e) {
+		t.Fatalf("Wait - expected first error have:%v", e)
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	const limit = 2
+	var running, max int32
+
+	g, _ := panics.NewGroup(context.Background(), false)
+	g.SetLimit(limit)
+	for i := 0; i < 10; i++ {
+		g.Go(func() error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&max)
+				if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+					break
+				}
+			}
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+	}
+	if e := g.Wait(); e != nil {
+		t.Fatalf("Wait - unexpected error: %s", e)
+	}
+	if max > limit {
+		t.Fatalf("limit - expected <= %d have:%d", limit, max)
+	}
+}
+
+func TestGroupZeroValue(t *testing.T) {
+	var g panics.Group
+	if e := g.Wait(); e != nil {
+		t.Fatalf("Wait - unexpected error: %s", e)
+	}
+	g.Go(okFunc)
+	g.Go(func() error {
+		panics.OnFalse(false, "zero group")
+		return nil
+	})
+	if e := g.Wait(); !errors.Assertion.Matches(e) {
+		t.Fatalf("Wait - expected assertion error have:%v", e)
+	}
+}
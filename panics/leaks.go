@@ -0,0 +1,152 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// goroutine leak detection
+// -----------------------------------------------------------------------
+
+// TB is the subset of testing.TB used by VerifyNoLeaks(), so that this
+// package does not depend on package testing.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Cleanup(fn func())
+}
+
+// time allowed for goroutines to finish once a test is done
+const leakTimeout = time.Second
+
+// goroutines ignored by VerifyNoLeaks(): test runner and runtime
+// (os/signal) goroutines.
+var leakIgnored = []string{
+	"testing.tRunner",
+	"testing.(*T).Run",
+	"testing.(*M).",
+	"testing.runTests",
+	"testing.runFuzzing",
+	"os/signal.signal_recv",
+	"runtime.ensureSigM",
+}
+
+// Verifies that a test does not leak goroutines, e.g. goroutines started
+// per Go() or AsyncRecover() that never return:
+//
+//    func TestWorkers(t *testing.T) {
+//        panics.VerifyNoLeaks(t)
+//        ...
+//    }
+//
+// The goroutines running at the time of the call are recorded. Once the
+// test is done (per t.Cleanup()), any other goroutines that are still
+// running after a grace period of 1s are reported per t.Errorf(), with
+// their stacks, including the function that created them.
+//
+// Goroutines whose stack includes any of the (package qualified) function
+// names or name fragments of input arg 'allow' are not reported, e.g.
+// intentional background workers:
+//
+//    panics.VerifyNoLeaks(t, "github.com/me/pkg.(*Cache).evict")
+func VerifyNoLeaks(t TB, allow ...string) {
+	t.Helper()
+	before := make(map[int]bool)
+	for _, g := range goroutines() {
+		before[g.id] = true
+	}
+	t.Cleanup(func() {
+		t.Helper()
+		deadline := time.Now().Add(leakTimeout)
+		delay := time.Millisecond
+		for {
+			leaked := leaks(before, allow)
+			if len(leaked) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				for _, g := range leaked {
+					t.Errorf("leaked goroutine %d:\n%s", g.id, g.stack)
+				}
+				return
+			}
+			time.Sleep(delay)
+			if delay < 100*time.Millisecond {
+				delay *= 2
+			}
+		}
+	})
+}
+
+// a goroutine per runtime.Stack()
+type goroutine struct {
+	id    int
+	stack string
+}
+
+// Returns all goroutines, except the calling goroutine.
+func goroutines() []goroutine {
+	self := parseGoroutine(string(currentStack()))
+	var all []goroutine
+	for _, block := range strings.Split(strings.TrimSpace(string(allStacks())), "\n\n") {
+		if g := parseGoroutine(block); g.id != 0 && g.id != self.id {
+			all = append(all, g)
+		}
+	}
+	return all
+}
+
+// Returns the goroutines not in 'before', nor ignored or allowed.
+func leaks(before map[int]bool, allow []string) []goroutine {
+	var leaked []goroutine
+	for _, g := range goroutines() {
+		if before[g.id] || stackContains(g.stack, leakIgnored) || stackContains(g.stack, allow) {
+			continue
+		}
+		leaked = append(leaked, g)
+	}
+	return leaked
+}
+
+func stackContains(stack string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(stack, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// parses a goroutine stack, e.g. "goroutine 7 [chan receive]:\n..."
+func parseGoroutine(block string) goroutine {
+	g := goroutine{stack: block}
+	fmt.Sscanf(block, "goroutine %d ", &g.id)
+	return g
+}
+
+// Returns the stack of the calling goroutine, per runtime.Stack().
+func currentStack() []byte {
+	buf := make([]byte, 1024)
+	n := runtime.Stack(buf, false)
+	return buf[:n]
+}
@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/panics"
+	"strings"
+	"testing"
+)
+
+// records the errors and cleanups of a test
+type fakeTB struct {
+	errors   []string
+	cleanups []func()
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Errorf(format string, args ...interface{}) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func (tb *fakeTB) Cleanup(fn func()) {
+	tb.cleanups = append(tb.cleanups, fn)
+}
+
+func (tb *fakeTB) done() []string {
+	for i := len(tb.cleanups) - 1; i >= 0; i-- {
+		tb.cleanups[i]()
+	}
+	return tb.errors
+}
+
+func leakyWorker(stop chan struct{}) {
+	stat := make(chan interface{}, 1)
+	go func() {
+		defer panics.AsyncRecover(stat, "ok")
+		<-stop
+	}()
+}
+
+func TestVerifyNoLeaks(t *testing.T) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	var tb fakeTB
+	panics.VerifyNoLeaks(&tb)
+	leakyWorker(stop)
+	errs := tb.done()
+	if len(errs) != 1 || !strings.Contains(errs[0], "leakyWorker") {
+		t.Fatalf("expected leaked worker - have:%q", errs)
+	}
+
+	tb = fakeTB{}
+	panics.VerifyNoLeaks(&tb, "leakyWorker")
+	leakyWorker(stop)
+	if errs := tb.done(); len(errs) != 0 {
+		t.Fatalf("expected allowed worker - have:%q", errs)
+	}
+}
+
+func TestVerifyNoLeaksFinished(t *testing.T) {
+	var tb fakeTB
+	panics.VerifyNoLeaks(&tb)
+	stop := make(chan struct{})
+	leakyWorker(stop)
+	close(stop)
+	if errs := tb.done(); len(errs) != 0 {
+		t.Fatalf("expected no leaks - have:%q", errs)
+	}
+}
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+// -----------------------------------------------------------------------
+// panics.Must
+// -----------------------------------------------------------------------
+
+// Must returns input arg 'v' if input arg 'e' is nil. Otherwise it
+// panics per OnError(e).
+//
+// Must reduces the noise of the common (value, error) call pattern:
+//
+//    func readConfig(filename string) (config *Config, err error) {
+//        defer panics.Recover(&err)
+//
+//        data := panics.Must(ioutil.ReadFile(filename))
+//        ...
+//    }
+func Must[T any](v T, e error) T {
+	OnError(e)
+	return v
+}
+
+// Must2 is the analog of Must for functions with 2 return values
+// (and an error).
+func Must2[A, B any](a A, b B, e error) (A, B) {
+	OnError(e)
+	return a, b
+}
+
+// MustWith is the analog of Must with the 'info' n-aray input arg
+// applied per OnError(e, info...). The value type must be explicitly
+// provided:
+//
+//    n := panics.MustWith[int]("parsing", s)(strconv.Atoi(s))
+func MustWith[T any](info ...interface{}) func(v T, e error) T {
+	return func(v T, e error) T {
+		OnError(e, info...)
+		return v
+	}
+}
+
+// Panics (per ForFunc) support.
+//
+// Interface methods can not be generic, so the Panics variants of the
+// above functions return interface{} values that require type assertion
+// at the call site:
+//
+//    panics := panics.ForFunc("readConfig")
+//    data := panics.Must(ioutil.ReadFile(filename)).([]byte)
+
+func (t *fnpanics) Must(v interface{}, e error) interface{} {
+	t.OnError(e)
+	return v
+}
+
+func (t *fnpanics) Must2(a, b interface{}, e error) (interface{}, interface{}) {
+	t.OnError(e)
+	return a, b
+}
+
+func (t *fnpanics) MustWith(info ...interface{}) func(v interface{}, e error) interface{} {
+	return func(v interface{}, e error) interface{} {
+		t.OnError(e, info...)
+		return v
+	}
+}
@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------
+// recovery observers
+// -----------------------------------------------------------------------
+
+// Recovery describes a panic recovered by one of the panics recovery
+// functions.
+type Recovery struct {
+	// Recovery function: "Recover", "AsyncRecover" or "ExitHandler".
+	Op string
+	// ExitHandler() label, or the ForFunc()/ForCaller() scope, if any.
+	Label string
+	// Policy in effect for the recovery. See Policy.
+	Policy Policy
+	// The recovered panic.
+	Recovered *Recovered
+	// Site of the panicking function, per Recovered.Site.
+	Site Site
+	// Stack of the panicking goroutine, per Recovered.Stack().
+	Stack []byte
+}
+
+// Observer is notified of recovered panics, per AddObserver(). Observers
+// are called synchronously by the recovery function, before the Policy
+// in effect is applied and, for ExitHandler(), before the process exits.
+// Observers must not block, and must be safe for concurrent use.
+type Observer func(r *Recovery)
+
+type observerEntry struct {
+	observer Observer
+}
+
+var (
+	// registered observers - copy on write
+	observers  atomic.Value
+	observerMu sync.Mutex
+)
+
+func init() {
+	observers.Store([]*observerEntry{})
+}
+
+// Registers input arg 'o' to be notified of all recovered panics, e.g.:
+//
+//    remove := panics.AddObserver(func(r *panics.Recovery) {
+//        log.Printf("%s: %s (at %s)", r.Op, r.Recovered, r.Site)
+//    })
+//    defer remove()
+//
+// Returns a function that removes the observer. A panic in an observer
+// is logged and otherwise ignored.
+func AddObserver(o Observer) (remove func()) {
+	entry := &observerEntry{o}
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	current := observers.Load().([]*observerEntry)
+	registered := make([]*observerEntry, len(current), len(current)+1)
+	copy(registered, current)
+	observers.Store(append(registered, entry))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { removeObserver(entry) })
+	}
+}
+
+func removeObserver(entry *observerEntry) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	current := observers.Load().([]*observerEntry)
+	registered := make([]*observerEntry, 0, len(current))
+	for _, e := range current {
+		if e != entry {
+			registered = append(registered, e)
+		}
+	}
+	observers.Store(registered)
+}
+
+// notifies the crash reporter, if any, and all registered observers of
+// the recovered panic 'rp'.
+func notify(op, label string, policy Policy, rp *Recovered) {
+	reportCrash(op, label, rp)
+	registered := observers.Load().([]*observerEntry)
+	if len(registered) == 0 {
+		return
+	}
+	r := &Recovery{
+		Op:        op,
+		Label:     label,
+		Policy:    policy,
+		Recovered: rp,
+		Site:      rp.Site,
+		Stack:     rp.Stack(),
+	}
+	for _, entry := range registered {
+		observe(entry.observer, r)
+	}
+}
+
+func observe(o Observer, r *Recovery) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("panics: observer panic: %v", p)
+		}
+	}()
+	o(r)
+}
@@ -0,0 +1,108 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"github.com/elasticsearch/kriterium/panics"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// records observed recoveries
+type spy struct {
+	mu         sync.Mutex
+	recoveries []*panics.Recovery
+}
+
+func (s *spy) observe(r *panics.Recovery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recoveries = append(s.recoveries, r)
+}
+
+func (s *spy) observed() []*panics.Recovery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.recoveries
+}
+
+func TestObserver(t *testing.T) {
+	var s spy
+	remove := panics.AddObserver(s.observe)
+	defer remove()
+
+	e := errFuncsApi[1]()
+	stat := make(chan interface{}, 1)
+	go func() {
+		defer panics.AsyncRecover(stat, "ok")
+		panics.OnTrue(true, "async")
+	}()
+	<-stat
+
+	observed := s.observed()
+	if len(observed) != 2 {
+		t.Fatalf("expected 2 recoveries - have:%d", len(observed))
+	}
+	r := observed[0]
+	if r.Op != "Recover" || r.Recovered != e || r.Site != r.Recovered.Site {
+		t.Fatalf("unexpected recovery: %+v", r)
+	}
+	if !strings.Contains(string(r.Stack), "goroutine") {
+		t.Fatalf("expected stack - have:%q", r.Stack)
+	}
+	if observed[1].Op != "AsyncRecover" {
+		t.Fatalf("expected AsyncRecover - have:%s", observed[1].Op)
+	}
+
+	remove()
+	remove()
+	errFuncsApi[1]()
+	if len(s.observed()) != 2 {
+		t.Fatal("expected no recoveries after remove")
+	}
+}
+
+func TestObserverScope(t *testing.T) {
+	var s spy
+	defer panics.AddObserver(s.observe)()
+
+	p := panics.ForFunc("TestObserverScope")
+	func() (err error) {
+		defer p.Recover(&err)
+		p.OnFalse(false, "scoped")
+		return
+	}()
+	if observed := s.observed(); len(observed) != 1 || !strings.Contains(observed[0].Label, "TestObserverScope") {
+		t.Fatalf("expected scoped recovery - have:%+v", observed)
+	}
+}
+
+func TestObserverPanic(t *testing.T) {
+	logged := captureLog(t)
+	defer panics.AddObserver(func(r *panics.Recovery) {
+		panic("observer")
+	})()
+
+	if e := errFuncsApi[1](); e == nil {
+		t.Fatal("expected recovered panic")
+	}
+	if !strings.Contains(logged.String(), "observer panic") {
+		t.Fatalf("expected observer panic to be logged - have:%q", logged)
+	}
+}
@@ -20,38 +20,32 @@ package panics
 
 import (
 	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
 	"log"
-	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
-	"time"
+	"sync/atomic"
 )
 
 // -----------------------------------------------------------------------
-// recoveredError with cause
+// recovered error cause
 // -----------------------------------------------------------------------
 
-// recoveredError type with option cause.
-// REVU: exporting this type and its member does not seem to be necessary.
-type recoveredError struct {
-	cause error
-	err   error
-}
-
-func (e recoveredError) Error() string {
-	return e.err.Error()
-}
-
 // Errors are returned by the panics package as plain 'error' references.
 // This function is used to obtain of the underlying cause of such errors.
 //
-// If the argument is not a panics.recoveredError reference, then it simply returns
-// the input argument.
+// If the argument is not a *panics.Recovered reference, or the recovered
+// panic has no distinct cause, then it simply returns the input argument.
+//
+// Cause only peels one layer. See errors.Chain() and errors.RootCause() for
+// walking the full chain of causes.
 func Cause(e error) error {
-	ex, ok := e.(*recoveredError)
-	if !ok {
+	ex, ok := e.(*Recovered)
+	if !ok || ex.Cause == nil {
 		return e
 	}
-	return ex.cause
+	return ex.Cause
 }
 
 // -----------------------------------------------------------------------
@@ -59,62 +53,136 @@ func Cause(e error) error {
 // -----------------------------------------------------------------------
 
 // Asserts that input arg 'flag' is true.
-// If false, panics with an recoveredError with descriptive cause based on the
-// 'info' n-aray input arg.
+// If false, panics with a *Recovered with an errors.Assertion cause with
+// descriptive message based on the 'info' n-aray input arg.
 func OnFalse(flag bool, info ...interface{}) {
 	if flag {
 		return
 	}
-	err := fmt.Errorf("%s - assert-fail:", fmtInfo(info...))
-	panic(&recoveredError{cause: err, err: err}) // REVU: this dup use of 'err' is wrong
+	raiseAs(errors.Assertion, KindFalse, fmt.Sprintf("%s - assert-fail:", fmtInfo(info...)), info)
 }
 
 // Asserts that input arg 'flag' is false.
-// If true, panics with an recoveredError with descriptive cause based on the
-// 'info' n-aray input arg.
+// If true, panics with a *Recovered with an errors.Assertion cause with
+// descriptive message based on the 'info' n-aray input arg.
 func OnTrue(flag bool, info ...interface{}) {
 	if !flag {
 		return
 	}
-	err := fmt.Errorf("%s - assert-fail:", fmtInfo(info...))
-	panic(&recoveredError{cause: err, err: err}) // REVU: this dup use of 'err' is wrong
+	raiseAs(errors.Assertion, KindTrue, fmt.Sprintf("%s - assert-fail:", fmtInfo(info...)), info)
 }
 
 // Asserts that input arg 'v' is not nil.
-// If nil, panics with an recoveredError with descriptive cause based on the
-// 'info' n-aray input arg.
+// If nil, panics with a *Recovered with an errors.Assertion cause with
+// descriptive message based on the 'info' n-aray input arg.
 func OnNil(v interface{}, info ...interface{}) {
 	if v != nil {
 		return
 	}
-	err := fmt.Errorf("%s - value is nil:", fmtInfo(info...))
-	panic(&recoveredError{cause: err, err: err}) // REVU: this dup use of 'err' is wrong
+	raiseAs(errors.Assertion, KindNil, fmt.Sprintf("%s - value is nil:", fmtInfo(info...)), info)
 }
 
 // Asserts that (error) input arg 'e' is nil.
-// If not nil, panics with the input arg 'e'
-// with descriptive cause based on the
+// If not nil, panics with a *Recovered with the input arg 'e'
+// as cause and descriptive message based on the
 // 'info' n-aray input arg.
 func OnError(e error, info ...interface{}) {
 	if e == nil {
 		return
 	}
-	var err error = e
+	raise(KindError, e, errorMsg(e, info), info)
+}
+
+// Returns the message of a panic on (error) input arg 'e' per OnError().
+func errorMsg(e error, info []interface{}) string {
+	msg := e.Error()
+	if len(info) > 0 {
+		msg = fmt.Sprintf("error: %s (cause: %s)", fmtInfo(info...), e)
+	} else if !strings.HasPrefix(msg, "error:") {
+		msg = fmt.Sprintf("error: %s%s", fmtInfo(info...), e)
+	}
+	return msg
+}
+
+// -----------------------------------------------------------------------
+// panics API - typed
+// -----------------------------------------------------------------------
+
+// Typed variants of the panics API raise errors of a specific TypedError
+// (in lieu of errors.Assertion), so that recovered errors can be matched
+// per the TypedError:
+//
+//    func configure(config *Config) (err error) {
+//        defer panics.Recover(&err)
+//        panics.OnNilAs(errors.IllegalArgument, config, "config")
+//        ...
+//    }
+//    ...
+//    e := configure(nil)
+//    if errors.IllegalArgument.Matches(e) {
+//        ...
+//    }
+//
+// A nil TypedError is equivalent to errors.Assertion.
+
+// See OnFalse(). Panics with a cause of TypedError 'te'.
+func OnFalseAs(te errors.TypedError, flag bool, info ...interface{}) {
+	if flag {
+		return
+	}
+	raiseAs(te, KindFalse, fmt.Sprintf("%s - assert-fail:", fmtInfo(info...)), info)
+}
+
+// See OnTrue(). Panics with a cause of TypedError 'te'.
+func OnTrueAs(te errors.TypedError, flag bool, info ...interface{}) {
+	if !flag {
+		return
+	}
+	raiseAs(te, KindTrue, fmt.Sprintf("%s - assert-fail:", fmtInfo(info...)), info)
+}
+
+// See OnNil(). Panics with a cause of TypedError 'te'.
+func OnNilAs(te errors.TypedError, v interface{}, info ...interface{}) {
+	if v != nil {
+		return
+	}
+	raiseAs(te, KindNil, fmt.Sprintf("%s - value is nil:", fmtInfo(info...)), info)
+}
+
+// See OnError(). Panics with a cause of TypedError 'te', which in turn
+// has input arg 'e' as its cause. A nil 'te' is equivalent to OnError().
+func OnErrorAs(te errors.TypedError, e error, info ...interface{}) {
+	if e == nil {
+		return
+	}
+	if te == nil {
+		OnError(e, info...)
+		return
+	}
+	var cause error
 	if len(info) > 0 {
-		err = fmt.Errorf("error: %s (cause: %s)", fmtInfo(info...), e)
-	} else if !strings.HasPrefix(e.Error(), "error:") {
-		err = fmt.Errorf("error: %s%s", fmtInfo(info...), e)
+		cause = te(fmtInfo(info...), e)
+	} else {
+		cause = te(e)
 	}
-	panic(&recoveredError{cause: e, err: err}) // REVU: this is correct use of error w/ cause
+	raise(KindError, cause, errorMsg(e, info), info)
 }
 
 // Recover encapsulates a generalized method of handing
 // recovered panics, per std. panic/recover mechanism.
 //
+// The recovered error is a *Recovered (see Recovered), except for a plain
+// panic with an error value (e.g. panic(io.EOF)), which is returned as
+// is.
+//
+// Recovery is subject to the Policy in effect. See Policy. Observers are
+// notified of the recovered panic. See AddObserver().
+//
 // Invocation of Recover() /must/ be deferred,
 // per semantics of Go recover().
 func Recover(err *error) error {
-	if DEBUG {
+	policy := policyInEffect(nil)
+	if policy.mode() == PolicyDebug {
 		return nil
 	}
 
@@ -123,16 +191,10 @@ func Recover(err *error) error {
 		return nil
 	}
 
-	switch t := p.(type) {
-	case *recoveredError:
-		*err = t
-	case error:
-		*err = t
-	case string:
-		*err = fmt.Errorf(t)
-	default:
-		*err = fmt.Errorf("recovered-panic: %q", t)
-	}
+	rp := recovered(p, "recovered-panic")
+	notify("Recover", "", policy, rp)
+	enforce(policy, rp)
+	*err = rp.returned()
 	return *err
 }
 
@@ -152,9 +214,15 @@ func Recover(err *error) error {
 // okstat: a user defined value used to signal that no panics
 // occurred in the goroutine.
 //
-// TODO: no rush but refactor this ..
+// The recovered panic sent on 'stat' is an error, per Recover().
+//
+// Recovery is subject to the Policy in effect. See Policy. Observers are
+// notified of the recovered panic. See AddObserver().
+//
+// See Go() for a typed alternative.
 func AsyncRecover(stat chan<- interface{}, okstat interface{}) {
-	if DEBUG {
+	policy := policyInEffect(nil)
+	if policy.mode() == PolicyDebug {
 		return
 	}
 
@@ -164,16 +232,10 @@ func AsyncRecover(stat chan<- interface{}, okstat interface{}) {
 		return
 	}
 
-	switch t := p.(type) {
-	case *recoveredError:
-		stat <- t
-	case error:
-		stat <- t
-	case string:
-		stat <- fmt.Errorf(t)
-	default:
-		stat <- fmt.Errorf("recovered-panic: %q", t)
-	}
+	rp := recovered(p, "recovered-panic")
+	notify("AsyncRecover", "", policy, rp)
+	enforce(policy, rp)
+	stat <- rp.returned()
 }
 
 // Exist handler is analogous to Recover() but intended for top-level
@@ -184,28 +246,29 @@ func AsyncRecover(stat chan<- interface{}, okstat interface{}) {
 //
 // Input arg 'label' is purely informational and used in creation
 // of the exit error.
+//
+// Recovery is subject to the Policy in effect. See Policy. Observers are
+// notified, and a crash report is written if enabled per
+// EnableCrashReports(), before exit.
+//
+// If signals are handled per HandleSignals(), the shutdown hooks are run
+// before exit. See Shutdown.
 func ExitHandler(label string) {
-	if DEBUG {
+	policy := policyInEffect(nil)
+	if policy.mode() == PolicyDebug {
 		return
 	}
 
 	p := recover()
 	if p == nil {
-		os.Exit(0)
+		exit(ExitOK)
 	}
 
-	var e error
-	switch t := p.(type) {
-	case *recoveredError:
-		e = t
-	case error:
-		e = t
-	case string:
-		e = fmt.Errorf(t)
-	default:
-		e = fmt.Errorf("recovered: %q", t)
-	}
-	log.Fatalf("fatal error: %s: %s", label, e)
+	rp := recovered(p, "recovered")
+	notify("ExitHandler", label, policy, rp)
+	enforce(policy, rp)
+	log.Printf("fatal error: %s: %s", label, rp)
+	exit(ExitFailure)
 }
 
 // -----------------------------------------------------------------------
@@ -229,7 +292,7 @@ func ExitHandler(label string) {
 //
 //    func something() (err error) {
 //        defer panics.Recover(&err)
-//        panics := panics.ForFunc("my-package/something():")
+//        panics := panics.ForFunc("my-package/something")
 //        ...
 //
 //        stat, e := os.Stat("no-such-file")
@@ -238,13 +301,96 @@ func ExitHandler(label string) {
 //
 //    }
 //
+// Any trailing "():" decoration of input arg 'fname' is ignored; the
+// info prefix is formatted per SetFuncFormat(). If 'fname' is "", the
+// function name is obtained per ForCaller().
 func ForFunc(fname string) Panics {
-	return &fnpanics{fname}
+	if fname == "" {
+		return forSite(caller(2))
+	}
+	fname = strings.TrimSuffix(strings.TrimSuffix(fname, ":"), "()")
+	return forSite(Site{Func: fname})
+}
+
+// ForCaller is the analog of ForFunc with the (package qualified)
+// function name, file and line of the caller obtained via runtime.Caller.
+//
+//    func something() (err error) {
+//        defer panics.Recover(&err)
+//        panics := panics.ForCaller()
+//        ...
+func ForCaller() Panics {
+	return forSite(caller(2))
+}
+
+func forSite(site Site) *fnpanics {
+	format := funcFormat.Load().(FuncFormat)
+	return &fnpanics{prefix: format(site)}
+}
+
+// Returns the site of the caller per runtime.Caller(skip).
+func caller(skip int) Site {
+	pc, file, line, ok := runtime.Caller(skip)
+	if !ok {
+		return Site{Func: "unknown"}
+	}
+	fname := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		fname = fn.Name()
+	}
+	return Site{file, line, fname}
+}
+
+// FuncFormat formats the info prefix of errors raised via a Panics
+// returned by ForFunc() or ForCaller(). Site.File and Site.Line are
+// only known for the latter.
+type FuncFormat func(site Site) string
+
+// Default FuncFormat. e.g. "github.com/me/pkg.something():"
+func FuncNameFormat(site Site) string {
+	return site.Func + "():"
+}
+
+// FuncFormat omitting the package path. e.g. "pkg.something():"
+func ShortFuncNameFormat(site Site) string {
+	fname := site.Func
+	if i := strings.LastIndex(fname, "/"); i >= 0 {
+		fname = fname[i+1:]
+	}
+	return fname + "():"
+}
+
+// FuncFormat including the file and line, if known.
+// e.g. "github.com/me/pkg.something() (file.go:42):"
+func FuncSiteFormat(site Site) string {
+	if site.File == "" {
+		return FuncNameFormat(site)
+	}
+	return fmt.Sprintf("%s() (%s:%d):", site.Func, filepath.Base(site.File), site.Line)
+}
+
+// the FuncFormat in effect.
+var funcFormat atomic.Value
+
+func init() {
+	funcFormat.Store(FuncFormat(FuncNameFormat))
+}
+
+// Sets the FuncFormat used by subsequently created ForFunc()/ForCaller()
+// Panics. A nil 'format' restores the default FuncNameFormat.
+func SetFuncFormat(format FuncFormat) {
+	if format == nil {
+		format = FuncNameFormat
+	}
+	funcFormat.Store(format)
 }
 
 type Panics interface {
 	// See panics.Recover()
 	Recover(err *error) error
+	// Returns a copy of this Panics with the recovery Policy 'p' in
+	// effect for its Recover(). See Policy.
+	WithPolicy(p Policy) Panics
 	// See panics.OnError()
 	OnError(e error, info ...interface{})
 	// See panics.OnNil()
@@ -253,14 +399,42 @@ type Panics interface {
 	OnFalse(flag bool, info ...interface{})
 	// See panics.OnTrue()
 	OnTrue(flag bool, info ...interface{})
+	// See panics.OnErrorAs()
+	OnErrorAs(te errors.TypedError, e error, info ...interface{})
+	// See panics.OnNilAs()
+	OnNilAs(te errors.TypedError, v interface{}, info ...interface{})
+	// See panics.OnFalseAs()
+	OnFalseAs(te errors.TypedError, flag bool, info ...interface{})
+	// See panics.OnTrueAs()
+	OnTrueAs(te errors.TypedError, flag bool, info ...interface{})
+	// See panics.OnNotEqual()
+	OnNotEqual(want, got interface{}, info ...interface{})
+	// See panics.OnOutOfRange()
+	OnOutOfRange(v, lo, hi interface{}, info ...interface{})
+	// See panics.OnEmpty()
+	OnEmpty(v interface{}, info ...interface{})
+	// See panics.OnLenNot()
+	OnLenNot(v interface{}, n int, info ...interface{})
+	// See panics.OnNotNil()
+	OnNotNil(v interface{}, info ...interface{})
+	// See panics.OnNotMatching()
+	OnNotMatching(re interface{}, s interface{}, info ...interface{})
+	// See panics.Must()
+	Must(v interface{}, e error) interface{}
+	// See panics.Must2()
+	Must2(a, b interface{}, e error) (interface{}, interface{})
+	// See panics.MustWith()
+	MustWith(info ...interface{}) func(v interface{}, e error) interface{}
 }
 
 type fnpanics struct {
-	fname string
+	prefix string  // formatted per FuncFormat
+	policy *Policy // scope policy, if any
 }
 
 func (t *fnpanics) Recover(err *error) error {
-	if DEBUG {
+	policy := policyInEffect(t.policy)
+	if policy.mode() == PolicyDebug {
 		return nil
 	}
 
@@ -269,21 +443,15 @@ func (t *fnpanics) Recover(err *error) error {
 		return nil
 	}
 
-	switch t := p.(type) {
-	case *recoveredError:
-		*err = t
-	case error:
-		*err = t
-	case string:
-		*err = fmt.Errorf(t)
-	default:
-		*err = fmt.Errorf("recovered-panic: %q", t)
-	}
+	rp := recovered(p, "recovered-panic")
+	notify("Recover", t.prefix, policy, rp)
+	enforce(policy, rp)
+	*err = rp
 	return *err
 }
 
 func (t *fnpanics) infoFixup(info ...interface{}) []interface{} {
-	infofn := []interface{}{t.fname + "():"}
+	infofn := []interface{}{t.prefix}
 	return append(infofn, info...)
 }
 func (t *fnpanics) OnError(e error, info ...interface{}) {
@@ -302,6 +470,22 @@ func (t *fnpanics) OnTrue(flag bool, info ...interface{}) {
 	infofn := t.infoFixup(info...)
 	OnTrue(flag, infofn...)
 }
+func (t *fnpanics) OnErrorAs(te errors.TypedError, e error, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnErrorAs(te, e, infofn...)
+}
+func (t *fnpanics) OnNilAs(te errors.TypedError, v interface{}, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnNilAs(te, v, infofn...)
+}
+func (t *fnpanics) OnFalseAs(te errors.TypedError, flag bool, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnFalseAs(te, flag, infofn...)
+}
+func (t *fnpanics) OnTrueAs(te errors.TypedError, flag bool, info ...interface{}) {
+	infofn := t.infoFixup(info...)
+	OnTrueAs(te, flag, infofn...)
+}
 
 // -----------------------------------------------------------------------
 // internal support
@@ -315,31 +499,24 @@ type stringCodec interface {
 
 // set to true to short circuit the panic recovery mechanism
 // and get the full stack dump per canonical panic().
+//
+// Deprecated: DEBUG is not safe for concurrent use and applies to the
+// entire process. Use SetPolicy(PolicyDebug), SetPackagePolicy() or
+// Panics.WithPolicy() instead. If true, it overrides all policies.
 var DEBUG = false
 
+// converts the recovered panic 'p' to a *Recovered. Non-error panic values
+// are described per 'label'. The recovery is counted per errors metrics.
+func recovered(p interface{}, label string) *Recovered {
+	rp := toRecovered(p, label)
+	errors.CountRecovered(rp)
+	return rp
+}
+
+// formats the info args per the Formatter in effect. See SetFormatter().
 func fmtInfo(info ...interface{}) string {
-	var msg = ""
-	if len(info) > 0 {
-		for _, s := range info {
-			str := ""
-			switch t := s.(type) {
-			case string:
-				str = t
-			case stringCodec:
-				str = t.String()
-			case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-				str = fmt.Sprintf("%d", t)
-			case time.Time:
-				str = fmt.Sprintf("'%d epoch-ns'", t.UnixNano())
-			case bool:
-				str = fmt.Sprintf("%t", t)
-			default:
-				str = fmt.Sprintf("%v", t)
-			}
-			str = " " + str
-			msg += str
-		}
-		msg = strings.Trim(msg, " ")
+	if len(info) == 0 {
+		return ""
 	}
-	return msg
+	return GetFormatter().Format(info)
 }
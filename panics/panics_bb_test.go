@@ -18,7 +18,12 @@
 package panics_test
 
 import (
-	"kriterium/panics"
+	stderrors "errors"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"io"
+	"runtime"
+	"strings"
 	"testing"
 	//	"testing/quick"
 	"fmt"
@@ -109,6 +114,7 @@ func TestPanicsErrorsAndRecoverForFunc(t *testing.T) {
 // test panics API functionality at call site - async
 // functions tested use panics API
 func TestAsyncPanicsErrorsAndRecoverForAPI(t *testing.T) {
+	panics.VerifyNoLeaks(t)
 	var okStat = "ok"
 
 	asyncFn := func(fn func() error, statchan chan<- interface{}) {
@@ -148,6 +154,7 @@ func TestAsyncPanicsErrorsAndRecoverForAPI(t *testing.T) {
 // test panics API functionality at call site - async
 // functions tested use panics.ForFunc API
 func TestAsyncPanicsErrorsAndRecoverForFunc(t *testing.T) {
+	panics.VerifyNoLeaks(t)
 	var okStat = "ok"
 
 	asyncFn := func(fn func() error, statchan chan<- interface{}) {
@@ -183,3 +190,219 @@ func TestAsyncPanicsErrorsAndRecoverForFunc(t *testing.T) {
 		t.Error("expected okStat")
 	}
 }
+
+// test that recovered typed errors are counted per errors metrics
+func TestRecoverCountsTypedErrors(t *testing.T) {
+	counters := errors.NewCounters("test")
+	errors.EnableMetrics(counters)
+	defer errors.DisableMetrics()
+
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		panics.OnError(errors.IllegalState("test"), "fn:")
+		return
+	}
+	if e := fn(); e == nil {
+		t.Fatal("expected to return error")
+	}
+
+	code := errors.IllegalState.Code()
+	if have := counters.Count(errors.Recovered, code); have != 1 {
+		t.Fatalf("recovered count - expected:%d have:%d\n", 1, have)
+	}
+}
+
+// test that recovered errors are *panics.Recovered with site information
+func TestRecoveredSiteAndKind(t *testing.T) {
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		panics.ForFunc("fn").OnNil(nil, "config")
+		return
+	}
+	e := fn()
+	rp, ok := e.(*panics.Recovered)
+	if !ok {
+		t.Fatalf("expected *panics.Recovered have:%T", e)
+	}
+	if rp.Kind != panics.KindNil {
+		t.Fatalf("Kind - expected:%s have:%s", panics.KindNil, rp.Kind)
+	}
+	if rp.Value != nil {
+		t.Fatalf("expected nil Value have:%#v", rp.Value)
+	}
+	if !strings.Contains(rp.Site.Func, "TestRecoveredSiteAndKind") || !strings.HasSuffix(rp.Site.File, "_test.go") {
+		t.Fatalf("unexpected Site:%s", rp.Site)
+	}
+	if len(rp.Info) == 0 || rp.Info[len(rp.Info)-1] != "config" {
+		t.Fatalf("unexpected Info:%v", rp.Info)
+	}
+	if len(rp.Stack()) == 0 {
+		t.Fatal("expected Stack")
+	}
+}
+
+// test that plain error panics are returned as is, and observed as
+// *panics.Recovered
+func TestRecoveredErrorAsIs(t *testing.T) {
+	var observed *panics.Recovered
+	defer panics.AddObserver(func(r *panics.Recovery) { observed = r.Recovered })()
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		panic(io.EOF)
+	}
+	if e := fn(); e != io.EOF {
+		t.Fatalf("expected io.EOF have:%#v", e)
+	}
+	if observed == nil || observed.Kind != panics.KindPanic || observed.Value != io.EOF || !stderrors.Is(observed, io.EOF) {
+		t.Fatalf("unexpected observed panic %#v", observed)
+	}
+}
+
+// test that plain panics are recovered as KindPanic with the original value
+func TestRecoveredPlainPanic(t *testing.T) {
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		panic("woof")
+	}
+	e := fn()
+	rp, ok := e.(*panics.Recovered)
+	if !ok {
+		t.Fatalf("expected *panics.Recovered have:%T", e)
+	}
+	if rp.Kind != panics.KindPanic || rp.Value != "woof" || rp.Error() != "woof" {
+		t.Fatalf("unexpected recovered panic %#v", rp)
+	}
+	if !strings.Contains(rp.Site.Func, "TestRecoveredPlainPanic") {
+		t.Fatalf("unexpected Site:%s", rp.Site)
+	}
+}
+
+func TestRecoveredRuntimeError(t *testing.T) {
+	fn := func() (err error) {
+		defer panics.Recover(&err)
+		var m map[string]int
+		m["woof"] = 1
+		return
+	}
+	e := fn()
+	rp, ok := e.(*panics.Recovered)
+	if !ok {
+		t.Fatalf("expected *panics.Recovered have:%T", e)
+	}
+	if rp.Kind != panics.KindRuntime || !errors.Runtime.Matches(e) || len(rp.Stack()) == 0 {
+		t.Fatalf("unexpected recovered panic %#v", rp)
+	}
+	if _, ok := errors.RootCause(e).(runtime.Error); !ok {
+		t.Fatalf("expected runtime.Error root cause have:\n%s", errors.FormatChain(e, false))
+	}
+	if !strings.Contains(rp.Site.Func, "TestRecoveredRuntimeError") {
+		t.Fatalf("unexpected Site:%s", rp.Site)
+	}
+}
+
+// test ForFunc/ForCaller info prefix formatting
+func TestForFuncPrefix(t *testing.T) {
+	onNil := func(p panics.Panics) (err error) {
+		defer panics.Recover(&err)
+		p.OnNil(nil, "config")
+		return
+	}
+
+	e := onNil(panics.ForFunc("my-package/something():"))
+	if have := e.Error(); !strings.HasPrefix(have, "my-package/something(): config - value is nil:") {
+		t.Fatalf("unexpected error: %s", have)
+	}
+
+	e = onNil(panics.ForCaller())
+	if have := e.Error(); !strings.Contains(have, "panics_test.TestForFuncPrefix():") {
+		t.Fatalf("unexpected error: %s", have)
+	}
+
+	panics.SetFuncFormat(panics.FuncSiteFormat)
+	defer panics.SetFuncFormat(nil)
+	e = onNil(panics.ForFunc(""))
+	if have := e.Error(); !strings.Contains(have, "TestForFuncPrefix() (panics_bb_test.go:") {
+		t.Fatalf("unexpected error: %s", have)
+	}
+}
+
+// test panics.Must & co
+func TestMust(t *testing.T) {
+	okFn := func() (int, error) { return 42, nil }
+	errFn := func() (int, error) { return 0, fmt.Errorf("test-error") }
+
+	fn := func(f func() (int, error)) (n int, err error) {
+		defer panics.Recover(&err)
+		n = panics.Must(f())
+		a, b := panics.Must2(f2(f))
+		n = panics.MustWith[int]("MustWith")(f()) + a - b
+		return
+	}
+
+	if n, e := fn(okFn); e != nil || n != 42 {
+		t.Fatalf("Must - expected:%d have:%d %v", 42, n, e)
+	}
+	if _, e := fn(errFn); e == nil {
+		t.Fatal("Must - expected error")
+	}
+
+	p := panics.ForFunc("TestMust")
+	forFn := func() (err error) {
+		defer p.Recover(&err)
+		p.MustWith("info")(errFn())
+		return
+	}
+	if e := forFn(); e == nil || !strings.Contains(e.Error(), "TestMust(): info") {
+		t.Fatalf("Panics.MustWith - unexpected error: %v", e)
+	}
+	if v := p.Must(okFn()).(int); v != 42 {
+		t.Fatalf("Panics.Must - expected:%d have:%d", 42, v)
+	}
+}
+
+func f2(f func() (int, error)) (int, int, error) {
+	n, e := f()
+	return n, n, e
+}
+
+// test typed panics
+func TestTypedPanics(t *testing.T) {
+	var tests = []struct {
+		te errors.TypedError
+		fn func()
+	}{
+		{errors.Assertion, func() { panics.OnFalse(false) }},
+		{errors.Assertion, func() { panics.OnTrue(true) }},
+		{errors.Assertion, func() { panics.OnNil(nil) }},
+		{errors.Assertion, func() { panics.OnNotEqual(1, 2) }},
+		{errors.IllegalArgument, func() { panics.OnNilAs(errors.IllegalArgument, nil, "config") }},
+		{errors.IllegalState, func() { panics.OnFalseAs(errors.IllegalState, false) }},
+		{errors.IllegalState, func() { panics.OnTrueAs(errors.IllegalState, true) }},
+		{errors.Usage, func() { panics.OnErrorAs(errors.Usage, fmt.Errorf("bad flag"), "flags") }},
+		{errors.Usage, func() { panics.ForFunc("fn").OnErrorAs(errors.Usage, fmt.Errorf("bad flag")) }},
+		{errors.NotSupported, func() { panics.OnError(errors.NotSupported("woof"), "info") }},
+	}
+	for i, test := range tests {
+		e := recoverFrom(test.fn)
+		if !test.te.Matches(e) {
+			t.Errorf("test %d: expected %q to match %q", i, e, test.te.Code())
+		}
+		if errors.Find(e, test.te) == nil {
+			t.Errorf("test %d: expected to find %q in %q", i, test.te.Code(), e)
+		}
+	}
+}
+
+// test that typed panics keep the message of their untyped counterpart
+func TestTypedPanicsMessage(t *testing.T) {
+	var tests = []struct{ typed, untyped func() }{
+		{func() { panics.OnNilAs(errors.IllegalArgument, nil, "config") }, func() { panics.OnNil(nil, "config") }},
+		{func() { panics.OnFalseAs(errors.IllegalState, false, "ready") }, func() { panics.OnFalse(false, "ready") }},
+		{func() { panics.OnErrorAs(errors.Usage, fmt.Errorf("bad flag"), "flags") }, func() { panics.OnError(fmt.Errorf("bad flag"), "flags") }},
+	}
+	for i, test := range tests {
+		if typed, untyped := recoverFrom(test.typed), recoverFrom(test.untyped); typed.Error() != untyped.Error() {
+			t.Errorf("test %d: expected %q have %q", i, untyped, typed)
+		}
+	}
+}
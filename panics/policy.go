@@ -0,0 +1,260 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// -----------------------------------------------------------------------
+// recovery policy
+// -----------------------------------------------------------------------
+
+// Policy determines how Recover(), AsyncRecover() and ExitHandler() treat
+// recovered panics.
+//
+// The policy in effect is, in order of precedence, the policy of the
+// ForFunc()/ForCaller() scope (see Panics.WithPolicy()), the policy set
+// for the package of the panicking function (see SetPackagePolicy()), or
+// the process wide policy (see SetPolicy()).
+//
+// The initial policies are set per the KRITERIUM_PANICS environment
+// variable: a comma separated list of policy names for the process wide
+// policy, and <package-path>=<policy name> for package policies. e.g.:
+//
+//    KRITERIUM_PANICS=debug
+//    KRITERIUM_PANICS=dump,github.com/me/mypkg=debug
+//    KRITERIUM_PANICS=recover+repanic-runtime
+type Policy uint32
+
+const (
+	// recover the panic (default)
+	PolicyRecover Policy = iota
+	// do not recover the panic: the panic propagates with the full stack
+	// dump per canonical panic().
+	PolicyDebug
+	// log the recovered panic and its stack, then re-panic.
+	PolicyRepanic
+	// log the recovered panic and its stack, then recover.
+	PolicyDump
+)
+
+// PolicyRepanicRuntime modifies any of the policies above: a recovered
+// runtime.Error panic (see KindRuntime) is re-panicked per PolicyRepanic,
+// while all other panics are treated per the modified policy, e.g.:
+//
+//    panics.SetPolicy(panics.PolicyRecover | panics.PolicyRepanicRuntime)
+//
+// Per ParsePolicy(), the name of the modifier is "repanic-runtime".
+const PolicyRepanicRuntime Policy = 1 << 16
+
+// mask of the policy modifiers
+const policyModifiers = PolicyRepanicRuntime
+
+// Returns the policy, sans modifiers.
+func (p Policy) mode() Policy {
+	return p &^ policyModifiers
+}
+
+// policy environment variable
+const policyEnv = "KRITERIUM_PANICS"
+
+var policyNames = map[Policy]string{
+	PolicyRecover: "recover",
+	PolicyDebug:   "debug",
+	PolicyRepanic: "repanic",
+	PolicyDump:    "dump",
+}
+
+// name of the PolicyRepanicRuntime modifier
+const repanicRuntimeName = "repanic-runtime"
+
+func (p Policy) String() string {
+	name, ok := policyNames[p.mode()]
+	if !ok {
+		name = fmt.Sprintf("Policy(%d)", uint32(p.mode()))
+	}
+	if p&PolicyRepanicRuntime != 0 {
+		name += "+" + repanicRuntimeName
+	}
+	return name
+}
+
+// Returns the Policy with the given name, per Policy.String(). Modifiers
+// are joined by '+', e.g. "dump+repanic-runtime". The name of a modifier
+// alone (e.g. "repanic-runtime") modifies PolicyRecover. Returns an
+// errors.IllegalArgument error if a name is unknown, or more than one
+// policy (other than modifiers) is given, e.g. "debug+repanic".
+func ParsePolicy(name string) (Policy, error) {
+	var policy Policy
+	modes := 0
+	for _, part := range strings.Split(name, "+") {
+		p, ok := parsePolicyName(part)
+		if !ok {
+			return PolicyRecover, errors.IllegalArgument("unknown panics policy:", name)
+		}
+		if p&policyModifiers == 0 {
+			if modes++; modes > 1 {
+				return PolicyRecover, errors.IllegalArgument("more than one panics policy:", name)
+			}
+		}
+		policy |= p
+	}
+	return policy, nil
+}
+
+func parsePolicyName(name string) (Policy, bool) {
+	if name == repanicRuntimeName {
+		return PolicyRepanicRuntime, true
+	}
+	for p, pname := range policyNames {
+		if pname == name {
+			return p, true
+		}
+	}
+	return PolicyRecover, false
+}
+
+var (
+	// the process wide policy
+	policy uint32
+	// package policies - copy on write
+	pkgPolicies atomic.Value
+	pkgMu       sync.Mutex
+)
+
+func init() {
+	pkgPolicies.Store(map[string]Policy{})
+	if e := policiesFromEnv(os.Getenv(policyEnv)); e != nil {
+		log.Printf("%s: %s", policyEnv, e)
+	}
+}
+
+func policiesFromEnv(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pkg, name := "", entry
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			pkg, name = entry[:i], entry[i+1:]
+		}
+		p, e := ParsePolicy(name)
+		if e != nil {
+			return e
+		}
+		if pkg == "" {
+			SetPolicy(p)
+		} else {
+			SetPackagePolicy(pkg, p)
+		}
+	}
+	return nil
+}
+
+// Sets the process wide Policy.
+func SetPolicy(p Policy) {
+	atomic.StoreUint32(&policy, uint32(p))
+}
+
+// Returns the process wide Policy.
+func GetPolicy() Policy {
+	return Policy(atomic.LoadUint32(&policy))
+}
+
+// Sets the Policy for panics raised by functions of the package with
+// (import) path 'pkg'.
+func SetPackagePolicy(pkg string, p Policy) {
+	pkgMu.Lock()
+	defer pkgMu.Unlock()
+	current := pkgPolicies.Load().(map[string]Policy)
+	policies := make(map[string]Policy, len(current)+1)
+	for k, v := range current {
+		policies[k] = v
+	}
+	policies[pkg] = p
+	pkgPolicies.Store(policies)
+}
+
+// Removes the Policy for the package with (import) path 'pkg', if any.
+func ClearPackagePolicy(pkg string) {
+	pkgMu.Lock()
+	defer pkgMu.Unlock()
+	current := pkgPolicies.Load().(map[string]Policy)
+	policies := make(map[string]Policy, len(current))
+	for k, v := range current {
+		if k != pkg {
+			policies[k] = v
+		}
+	}
+	pkgPolicies.Store(policies)
+}
+
+// Returns the Policy in effect for a recovery function. Input arg
+// 'scoped' is the ForFunc scope policy, if any.
+//
+// NOTE: must be called by the recovery function itself, before the
+// panic is recovered.
+func policyInEffect(scoped *Policy) Policy {
+	if DEBUG {
+		return PolicyDebug
+	}
+	if scoped != nil {
+		return *scoped
+	}
+	if policies := pkgPolicies.Load().(map[string]Policy); len(policies) > 0 {
+		site := panicSite()
+		if p, ok := policies[funcPackage(site.Func)]; ok {
+			return p
+		}
+	}
+	return GetPolicy()
+}
+
+// Applies Policy 'p' to the recovered panic 'rp'. Per PolicyRepanic,
+// this function panics.
+func enforce(p Policy, rp *Recovered) {
+	mode := p.mode()
+	if p&PolicyRepanicRuntime != 0 && rp.Kind == KindRuntime {
+		mode = PolicyRepanic
+	}
+	switch mode {
+	case PolicyRepanic:
+		log.Printf("panics: re-panic: %s (at %s)\n%s", rp, rp.Site, rp.Stack())
+		panic(rp)
+	case PolicyDump:
+		log.Printf("panics: recovered: %s (at %s)\n%s", rp, rp.Site, rp.Stack())
+	}
+}
+
+// -----------------------------------------------------------------------
+// panics.ForFunc - policy
+// -----------------------------------------------------------------------
+
+func (t *fnpanics) WithPolicy(p Policy) Panics {
+	scoped := *t
+	scoped.policy = &p
+	return &scoped
+}
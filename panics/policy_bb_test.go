@@ -0,0 +1,183 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"bytes"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// package path of this (test) package
+var testpkg = reflect.TypeOf(point{}).PkgPath()
+
+// runs fn, which is expected to return normally or panic, and returns
+// its error, or the value of a propagated panic.
+func runUnrecovered(fn func() error) (err error, propagated interface{}) {
+	defer func() {
+		propagated = recover()
+	}()
+	err = fn()
+	return
+}
+
+// captures the std logger output for the duration of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestPackagePolicy(t *testing.T) {
+	panics.SetPackagePolicy(testpkg, panics.PolicyDebug)
+	defer panics.ClearPackagePolicy(testpkg)
+
+	e, propagated := runUnrecovered(errFuncsApi[1])
+	if e != nil || propagated == nil {
+		t.Fatalf("expected propagated panic - have:(%v, %v)", e, propagated)
+	}
+
+	panics.ClearPackagePolicy(testpkg)
+	e, propagated = runUnrecovered(errFuncsApi[1])
+	if e == nil || propagated != nil {
+		t.Fatalf("expected recovered panic - have:(%v, %v)", e, propagated)
+	}
+}
+
+func TestScopePolicy(t *testing.T) {
+	logged := captureLog(t)
+	p := panics.ForFunc("TestScopePolicy")
+
+	e, propagated := runUnrecovered(func() (err error) {
+		defer p.WithPolicy(panics.PolicyRepanic).Recover(&err)
+		p.OnNil(nil, "repanic")
+		return
+	})
+	if _, ok := propagated.(*panics.Recovered); e != nil || !ok {
+		t.Fatalf("expected re-panic - have:(%v, %v)", e, propagated)
+	}
+	if !strings.Contains(logged.String(), "re-panic") {
+		t.Fatalf("expected re-panic to be logged - have: %q", logged)
+	}
+
+	logged.Reset()
+	e, propagated = runUnrecovered(func() (err error) {
+		defer p.WithPolicy(panics.PolicyDump).Recover(&err)
+		p.OnNil(nil, "dump")
+		return
+	})
+	if e == nil || propagated != nil {
+		t.Fatalf("expected recovered panic - have:(%v, %v)", e, propagated)
+	}
+	if !strings.Contains(logged.String(), "goroutine") {
+		t.Fatalf("expected stack dump - have: %q", logged)
+	}
+}
+
+func TestPolicyConcurrentUpdates(t *testing.T) {
+	captureLog(t)
+	defer panics.SetPolicy(panics.PolicyRecover)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			panics.SetPolicy(panics.PolicyDump)
+			panics.SetPackagePolicy("example.com/other", panics.PolicyRecover)
+			panics.SetPolicy(panics.PolicyRecover)
+		}()
+		go func() {
+			defer wg.Done()
+			panics.GetPolicy()
+			errFuncsApi[0]()
+		}()
+	}
+	wg.Wait()
+	panics.ClearPackagePolicy("example.com/other")
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []panics.Policy{panics.PolicyRecover, panics.PolicyDebug, panics.PolicyRepanic, panics.PolicyDump} {
+		if have, e := panics.ParsePolicy(p.String()); e != nil || have != p {
+			t.Fatalf("ParsePolicy(%q) - expected:%s have:(%s, %v)", p, p, have, e)
+		}
+	}
+	p := panics.PolicyDump | panics.PolicyRepanicRuntime
+	if have, e := panics.ParsePolicy(p.String()); e != nil || have != p {
+		t.Fatalf("ParsePolicy(%q) - expected:%s have:(%s, %v)", p, p, have, e)
+	}
+	if have, _ := panics.ParsePolicy("repanic-runtime"); have != panics.PolicyRecover|panics.PolicyRepanicRuntime {
+		t.Fatalf("ParsePolicy(repanic-runtime) - have:%s", have)
+	}
+	for _, name := range []string{"woof", "", "dump+woof", "debug+repanic", "recover+dump", "dump+debug", "recover+recover"} {
+		if _, e := panics.ParsePolicy(name); !errors.IllegalArgument.Matches(e) {
+			t.Fatalf("ParsePolicy(%q) - expected IllegalArgument error have:%v", name, e)
+		}
+	}
+}
+
+func TestPolicyRepanicRuntime(t *testing.T) {
+	captureLog(t)
+	panics.SetPolicy(panics.PolicyRecover | panics.PolicyRepanicRuntime)
+	defer panics.SetPolicy(panics.PolicyRecover)
+
+	e, propagated := runUnrecovered(func() (err error) {
+		defer panics.Recover(&err)
+		var p *point
+		_ = p.X
+		return
+	})
+	if rp, ok := propagated.(*panics.Recovered); e != nil || !ok || rp.Kind != panics.KindRuntime {
+		t.Fatalf("expected runtime error re-panic - have:(%v, %v)", e, propagated)
+	}
+
+	e, propagated = runUnrecovered(errFuncsApi[1])
+	if e == nil || propagated != nil {
+		t.Fatalf("expected recovered panic - have:(%v, %v)", e, propagated)
+	}
+}
+
+// checks policies set per environment variable in a child process.
+func TestPolicyFromEnv(t *testing.T) {
+	if os.Getenv("KRITERIUM_TEST_POLICY_CHILD") != "" {
+		if panics.GetPolicy() != panics.PolicyDump {
+			t.Fatalf("expected:%s have:%s", panics.PolicyDump, panics.GetPolicy())
+		}
+		if _, propagated := runUnrecovered(errFuncsApi[1]); propagated == nil {
+			t.Fatal("expected package policy debug")
+		}
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestPolicyFromEnv$")
+	cmd.Env = append(os.Environ(),
+		"KRITERIUM_TEST_POLICY_CHILD=1",
+		"KRITERIUM_PANICS=dump,"+testpkg+"=debug")
+	if out, e := cmd.CombinedOutput(); e != nil {
+		t.Fatalf("child process failed: %s\n%s", e, out)
+	}
+}
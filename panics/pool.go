@@ -0,0 +1,311 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// panics.Pool
+// -----------------------------------------------------------------------
+
+// PoolSpec specifies the workers, queue and task timeout of a Pool.
+type PoolSpec struct {
+	// Number of (fixed) workers. Defaults to runtime.GOMAXPROCS(0).
+	Workers int
+	// Max number of workers. If greater than Workers, the pool is elastic:
+	// additional workers are started while tasks are queued, and stop
+	// once idle for IdleTimeout. Otherwise the pool is fixed.
+	MaxWorkers int
+	// Idle timeout of elastic workers. Defaults to 1s.
+	IdleTimeout time.Duration
+	// Capacity of the task queue. Defaults to Workers.
+	QueueSize int
+	// Timeout of each task, per Within(). Zero for no timeout. A timed out
+	// task fails, and its worker moves on: the task should observe its
+	// context.
+	TaskTimeout time.Duration
+	// Called with the error of each failed task, if not nil. Must be safe
+	// for concurrent use.
+	OnError func(e error)
+}
+
+// PoolStats is a snapshot of the task counts of a Pool. Failed tasks
+// include tasks that panicked, timed out, or were discarded on shutdown.
+// Panicked tasks are failed tasks with a recovered panic.
+type PoolStats struct {
+	Submitted int64
+	Completed int64
+	Failed    int64
+	Panicked  int64
+	InFlight  int64
+	Queued    int64
+	Workers   int64
+}
+
+// Pool runs submitted tasks on a bounded number of worker goroutines. A
+// panic in a task is recovered per Recover() and fails the task only: the
+// worker carries on with the next task.
+//
+//    pool := panics.NewPool(ctx, panics.PoolSpec{
+//        Workers:     4,
+//        MaxWorkers:  16,
+//        QueueSize:   100,
+//        TaskTimeout: 10 * time.Second,
+//        OnError: func(e error) {
+//            log.Printf("plugin: %s", e)
+//        },
+//    })
+//    for _, plugin := range plugins {
+//        pool.Submit(ctx, plugin.Run)
+//    }
+//    ...
+//    e := pool.Shutdown(ctx)
+type Pool struct {
+	spec   PoolSpec
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan func(ctx context.Context) error
+	wg     sync.WaitGroup
+	mu     sync.RWMutex // guards closed and sends on queue
+	closed bool
+	// closed on Shutdown(), before p.mu is locked, to release blocked
+	// Submit() calls
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	submitted, completed, failed, panicked, inFlight, workers int64
+}
+
+// Returns a new Pool per PoolSpec 'spec', with its (fixed) workers
+// started. Tasks are run with a context derived from 'ctx'.
+func NewPool(ctx context.Context, spec PoolSpec) *Pool {
+	if spec.Workers <= 0 {
+		spec.Workers = runtime.GOMAXPROCS(0)
+	}
+	if spec.MaxWorkers < spec.Workers {
+		spec.MaxWorkers = spec.Workers
+	}
+	if spec.IdleTimeout <= 0 {
+		spec.IdleTimeout = time.Second
+	}
+	if spec.QueueSize <= 0 {
+		spec.QueueSize = spec.Workers
+	}
+	p := &Pool{
+		spec:    spec,
+		queue:   make(chan func(ctx context.Context) error, spec.QueueSize),
+		closing: make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	p.workers = int64(spec.Workers)
+	p.wg.Add(spec.Workers)
+	for i := 0; i < spec.Workers; i++ {
+		go p.work(false)
+	}
+	return p
+}
+
+// Queues input arg 'task' to be run by a worker. If the queue is full,
+// Submit blocks until the task is queued, 'ctx' is done, or the pool is
+// shut down. Returns an errors.IllegalState error if the pool is shut
+// down, or an error per OnDone() if 'ctx' is done.
+func (p *Pool) Submit(ctx context.Context, task func(ctx context.Context) error) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return errors.IllegalState("pool is shut down")
+	}
+	select {
+	case p.queue <- task:
+	default:
+		p.grow()
+		select {
+		case p.queue <- task:
+		case <-ctx.Done():
+			return doneError(ctx, "pool submit:")
+		case <-p.closing:
+			return errors.IllegalState("pool is shut down")
+		}
+	}
+	atomic.AddInt64(&p.submitted, 1)
+	p.grow()
+	return nil
+}
+
+// Queues input arg 'task' if the queue is not full. Returns false if the
+// task is not queued, i.e. the queue is full or the pool is shut down.
+func (p *Pool) TrySubmit(task func(ctx context.Context) error) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.queue <- task:
+	default:
+		p.grow()
+		return false
+	}
+	atomic.AddInt64(&p.submitted, 1)
+	p.grow()
+	return true
+}
+
+// Stops accepting tasks and waits for the workers to drain the queue. If
+// 'ctx' is done first, the contexts of running tasks are canceled, queued
+// tasks are discarded, and an error per OnDone() is returned.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.closingOnce.Do(func() { close(p.closing) })
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-drained
+		return doneError(ctx, "pool shutdown:")
+	}
+}
+
+// Returns a snapshot of the task counts of the pool.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Submitted: atomic.LoadInt64(&p.submitted),
+		Completed: atomic.LoadInt64(&p.completed),
+		Failed:    atomic.LoadInt64(&p.failed),
+		Panicked:  atomic.LoadInt64(&p.panicked),
+		InFlight:  atomic.LoadInt64(&p.inFlight),
+		Queued:    int64(len(p.queue)),
+		Workers:   atomic.LoadInt64(&p.workers),
+	}
+}
+
+func (p *Pool) String() string {
+	s := p.Stats()
+	return fmt.Sprintf("pool: %d workers, %d queued, %d in-flight, %d completed, %d failed (%d panicked)",
+		s.Workers, s.Queued, s.InFlight, s.Completed, s.Failed, s.Panicked)
+}
+
+// starts an elastic worker if more tasks are queued than there are idle
+// workers, and the max number of workers is not reached. Called with p.mu
+// read locked.
+func (p *Pool) grow() {
+	idle := atomic.LoadInt64(&p.workers) - atomic.LoadInt64(&p.inFlight)
+	if int64(len(p.queue)) <= idle {
+		return
+	}
+	for {
+		n := atomic.LoadInt64(&p.workers)
+		if n >= int64(p.spec.MaxWorkers) {
+			return
+		}
+		if atomic.CompareAndSwapInt64(&p.workers, n, n+1) {
+			p.wg.Add(1)
+			go p.work(true)
+			return
+		}
+	}
+}
+
+func (p *Pool) work(elastic bool) {
+	defer p.wg.Done()
+	defer atomic.AddInt64(&p.workers, -1)
+
+	var idle <-chan time.Time
+	for {
+		if elastic {
+			idle = time.After(p.spec.IdleTimeout)
+		}
+		select {
+		case task, ok := <-p.queue:
+			if !ok {
+				return
+			}
+			p.run(task)
+		case <-idle:
+			return
+		}
+	}
+}
+
+func (p *Pool) run(task func(ctx context.Context) error) {
+	atomic.AddInt64(&p.inFlight, 1)
+	defer atomic.AddInt64(&p.inFlight, -1)
+
+	// set if the task panics, and its panic is recovered
+	var panicked int32
+	pooled := func(ctx context.Context) error {
+		return runPooled(ctx, task, &panicked)
+	}
+
+	var e error
+	switch {
+	case p.ctx.Err() != nil:
+		e = doneError(p.ctx, "pool task discarded:")
+	case p.spec.TaskTimeout > 0:
+		e = Within(p.ctx, p.spec.TaskTimeout, pooled)
+	default:
+		e = pooled(p.ctx)
+	}
+
+	if e == nil {
+		atomic.AddInt64(&p.completed, 1)
+		return
+	}
+	atomic.AddInt64(&p.failed, 1)
+	// a timed out task may still be running
+	if atomic.LoadInt32(&panicked) != 0 {
+		atomic.AddInt64(&p.panicked, 1)
+	}
+	if p.spec.OnError != nil {
+		p.spec.OnError(e)
+	}
+}
+
+func runPooled(ctx context.Context, task func(ctx context.Context) error, panicked *int32) (err error) {
+	returned := false
+	defer func() {
+		if !returned {
+			atomic.StoreInt32(panicked, 1)
+		}
+	}()
+	defer Recover(&err)
+	err = task(ctx)
+	returned = true
+	return
+}
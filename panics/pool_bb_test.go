@@ -0,0 +1,202 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPoolRecoversTasks(t *testing.T) {
+	var mu sync.Mutex
+	var failures []error
+	ctx := context.Background()
+	pool := panics.NewPool(ctx, panics.PoolSpec{
+		Workers: 2,
+		OnError: func(e error) {
+			mu.Lock()
+			failures = append(failures, e)
+			mu.Unlock()
+		},
+	})
+
+	tasks := []func(ctx context.Context) error{
+		func(ctx context.Context) error { return nil },
+		func(ctx context.Context) error { return fmt.Errorf("woof") },
+		func(ctx context.Context) error {
+			panics.OnNilAs(errors.IllegalArgument, nil, "plugin")
+			return nil
+		},
+		func(ctx context.Context) error {
+			var m map[string]int
+			m["boom"] = 1
+			return nil
+		},
+		func(ctx context.Context) error { return nil },
+	}
+	for _, task := range tasks {
+		if e := pool.Submit(ctx, task); e != nil {
+			t.Fatalf("Submit - unexpected error: %s", e)
+		}
+	}
+	if e := pool.Shutdown(ctx); e != nil {
+		t.Fatalf("Shutdown - unexpected error: %s", e)
+	}
+
+	stats := pool.Stats()
+	expected := panics.PoolStats{Submitted: 5, Completed: 2, Failed: 3, Panicked: 2}
+	if stats != expected {
+		t.Fatalf("Stats - expected:%+v have:%+v", expected, stats)
+	}
+	if len(failures) != 3 || !errors.IllegalArgument.Matches(errors.Join(failures...)) {
+		t.Fatalf("expected 3 failures have:%q", failures)
+	}
+	if e := pool.Submit(ctx, tasks[0]); !errors.IllegalState.Matches(e) {
+		t.Fatalf("Submit - expected illegal state have:%v", e)
+	}
+}
+
+func TestPoolTaskTimeout(t *testing.T) {
+	ctx := context.Background()
+	pool := panics.NewPool(ctx, panics.PoolSpec{Workers: 1, TaskTimeout: 10 * time.Millisecond})
+	pool.Submit(ctx, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	pool.Shutdown(ctx)
+	if stats := pool.Stats(); stats.Failed != 1 || stats.Panicked != 0 {
+		t.Fatalf("expected timed out task have:%+v", stats)
+	}
+}
+
+func TestPoolElastic(t *testing.T) {
+	ctx := context.Background()
+	pool := panics.NewPool(ctx, panics.PoolSpec{
+		Workers:     1,
+		MaxWorkers:  4,
+		QueueSize:   8,
+		IdleTimeout: 10 * time.Millisecond,
+	})
+	release := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		pool.Submit(ctx, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+	}
+	if n := pool.Stats().Workers; n <= 1 || n > 4 {
+		t.Fatalf("expected elastic workers have:%d", n)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for pool.Stats().Workers > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected idle elastic workers to stop have:%s", pool)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if e := pool.Shutdown(ctx); e != nil || pool.Stats().Completed != 8 {
+		t.Fatalf("Shutdown - unexpected:(%v, %s)", e, pool)
+	}
+}
+
+func TestPoolShutdownDeadline(t *testing.T) {
+	ctx := context.Background()
+	pool := panics.NewPool(ctx, panics.PoolSpec{Workers: 1, QueueSize: 4})
+	for i := 0; i < 4; i++ {
+		pool.Submit(ctx, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+
+	shutdown, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if e := pool.Shutdown(shutdown); !errors.DeadlineExceeded.Matches(e) {
+		t.Fatalf("Shutdown - expected deadline exceeded have:%v", e)
+	}
+	if stats := pool.Stats(); stats.Failed != 4 || stats.InFlight != 0 || stats.Queued != 0 {
+		t.Fatalf("expected all tasks failed have:%+v", stats)
+	}
+	if pool.TrySubmit(func(ctx context.Context) error { return nil }) {
+		t.Fatal("TrySubmit - expected false")
+	}
+}
+
+func TestPoolShutdownBlockedSubmit(t *testing.T) {
+	ctx := context.Background()
+	pool := panics.NewPool(ctx, panics.PoolSpec{Workers: 1, QueueSize: 1})
+	wait := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	pool.Submit(ctx, wait)
+	pool.Submit(ctx, wait)
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- pool.Submit(ctx, wait)
+	}()
+	for pool.Stats().Queued == 0 || pool.Stats().InFlight == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// let the third Submit block on the full queue
+	time.Sleep(20 * time.Millisecond)
+
+	shutdown, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Shutdown(shutdown)
+	}()
+	select {
+	case e := <-done:
+		if !errors.DeadlineExceeded.Matches(e) {
+			t.Fatalf("Shutdown - expected deadline exceeded have:%v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown - deadlocked")
+	}
+	if e := <-submitted; !errors.IllegalState.Matches(e) {
+		t.Fatalf("Submit - expected illegal state have:%v", e)
+	}
+}
+
+func TestPoolPanickedCount(t *testing.T) {
+	ctx := context.Background()
+	pool := panics.NewPool(ctx, panics.PoolSpec{Workers: 1, TaskTimeout: time.Second})
+	// a task recovering its own panic per the panics idiom
+	pool.Submit(ctx, func(ctx context.Context) (err error) {
+		defer panics.Recover(&err)
+		panics.OnFalse(false, "recovered by the task")
+		return
+	})
+	pool.Submit(ctx, func(ctx context.Context) error {
+		panics.OnFalse(false, "recovered by the pool")
+		return nil
+	})
+	pool.Shutdown(ctx)
+	if stats := pool.Stats(); stats.Failed != 2 || stats.Panicked != 1 {
+		t.Fatalf("expected 1 panicked task have:%+v", stats)
+	}
+}
@@ -0,0 +1,288 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// -----------------------------------------------------------------------
+// Recovered panics
+// -----------------------------------------------------------------------
+
+// Kind of the (assertion) call that raised a panic.
+type Kind int
+
+const (
+	KindPanic       Kind = iota // a panic not raised via the panics API
+	KindError                   // panics.OnError
+	KindNil                     // panics.OnNil
+	KindFalse                   // panics.OnFalse
+	KindTrue                    // panics.OnTrue
+	KindNotEqual                // panics.OnNotEqual
+	KindOutOfRange              // panics.OnOutOfRange
+	KindEmpty                   // panics.OnEmpty
+	KindLenNot                  // panics.OnLenNot
+	KindNotNil                  // panics.OnNotNil
+	KindNotMatching             // panics.OnNotMatching
+	KindRuntime                 // a runtime.Error panic, e.g. nil dereference
+	KindRequire                 // panics.Require, panics.RequireFunc
+	KindEnsure                  // panics.Ensure
+	KindInvariant               // panics.Guard
+	KindDone                    // panics.OnDone
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindPanic:
+		return "panic"
+	case KindError:
+		return "OnError"
+	case KindNil:
+		return "OnNil"
+	case KindFalse:
+		return "OnFalse"
+	case KindTrue:
+		return "OnTrue"
+	case KindNotEqual:
+		return "OnNotEqual"
+	case KindOutOfRange:
+		return "OnOutOfRange"
+	case KindEmpty:
+		return "OnEmpty"
+	case KindLenNot:
+		return "OnLenNot"
+	case KindNotNil:
+		return "OnNotNil"
+	case KindNotMatching:
+		return "OnNotMatching"
+	case KindRuntime:
+		return "runtime"
+	case KindRequire:
+		return "Require"
+	case KindEnsure:
+		return "Ensure"
+	case KindInvariant:
+		return "Invariant"
+	case KindDone:
+		return "OnDone"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Site is the call site of a panicking call.
+type Site struct {
+	File string
+	Line int
+	Func string // package qualified function name
+}
+
+func (s Site) String() string {
+	if s.File == "" {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s (%s:%d)", s.Func, s.File, s.Line)
+}
+
+// Recovered is the error type of the panics recovered by Recover(),
+// AsyncRecover() and ExitHandler(). Recover() and AsyncRecover() return
+// the value of a plain error panic (e.g. panic(io.EOF)) as is, while
+// observers are notified with a *Recovered for all recovered panics.
+//
+// Panics raised via the panics API (OnError, OnNil, etc.) record the
+// assertion kind, the formatted info args and the site of the call, with
+// a nil Value.
+// Any other recovered panic is of KindPanic, with Value set to the
+// original panic value and Site set to the panicking function, except for
+// runtime.Error panics (nil dereference, index out of range, etc.), which
+// are of KindRuntime with a Cause of errors.Runtime wrapping the
+// runtime.Error. Runtime errors are programming errors rather than
+// pseudo-exceptions. See PolicyRepanicRuntime.
+//
+// usage example:
+//    func something() (err error) {
+//        defer panics.Recover(&err)
+//        ...
+//    }
+//    ...
+//    if e := something(); e != nil {
+//        if rp, ok := e.(*panics.Recovered); ok {
+//            log.Printf("%s at %s\n%s", rp.Kind, rp.Site, rp.Stack())
+//        }
+//    }
+type Recovered struct {
+	Value interface{}   // original panic value, nil if raised via the panics API
+	Cause error         // underlying cause, if any
+	Info  []interface{} // info args of the panics API call, if any
+	Kind  Kind          // kind of the panicking call
+	Site  Site          // site of the panicking call
+	msg   string
+	stack []byte
+}
+
+func (e *Recovered) Error() string {
+	return e.msg
+}
+
+func (e *Recovered) Unwrap() error {
+	return e.Cause
+}
+
+// Returns the stack of the panicking goroutine, per debug.Stack().
+func (e *Recovered) Stack() []byte {
+	return e.stack
+}
+
+// Returns the error returned by Recover() and AsyncRecover() for the
+// recovered panic: the original panic value of a plain error panic, for
+// compatibility, or the *Recovered itself.
+func (e *Recovered) returned() error {
+	if v, ok := e.Value.(error); ok && e.Kind == KindPanic {
+		return v
+	}
+	return e
+}
+
+// raises a panic of the given kind on behalf of a panics API call.
+func raise(kind Kind, cause error, msg string, info []interface{}) {
+	rp := &Recovered{
+		Cause: cause,
+		Info:  info,
+		Kind:  kind,
+		Site:  callSite(),
+		msg:   msg,
+		stack: debug.Stack(),
+	}
+	panic(rp)
+}
+
+// raises a panic of the given kind on behalf of a panics API call, with
+// message 'msg' and a cause of TypedError 'te' (or errors.Assertion, if
+// nil).
+func raiseAs(te errors.TypedError, kind Kind, msg string, info []interface{}) {
+	if te == nil {
+		te = errors.Assertion
+	}
+	raise(kind, te(msg), msg, info)
+}
+
+// converts the panic value 'p', recovered by one of the panics recovery
+// functions, to a *Recovered. Non-error panic values are described per
+// 'label'.
+//
+// NOTE: must be called by the recovery function itself, so that the
+// panicking frames are still on the stack.
+func toRecovered(p interface{}, label string) *Recovered {
+	if rp, ok := p.(*Recovered); ok {
+		return rp
+	}
+	rp := &Recovered{
+		Value: p,
+		Kind:  KindPanic,
+		Site:  panicSite(),
+		stack: debug.Stack(),
+	}
+	switch t := p.(type) {
+	case runtime.Error:
+		rp.Kind = KindRuntime
+		rp.Cause = errors.Runtime(t)
+		rp.msg = rp.Cause.Error()
+	case error:
+		rp.Cause = t
+		rp.msg = t.Error()
+	case string:
+		rp.msg = t
+	default:
+		rp.msg = fmt.Sprintf("%s: %q", label, t)
+	}
+	return rp
+}
+
+// -----------------------------------------------------------------------
+// call site support
+// -----------------------------------------------------------------------
+
+// package path of this package.
+var pkgpath = reflect.TypeOf(Site{}).PkgPath()
+
+// Returns the first frame on the stack that is not in this package (or
+// its sub-packages), i.e. the caller of the panics API.
+func callSite() Site {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !inPackage(frame.Function) {
+			return Site{frame.File, frame.Line, frame.Function}
+		}
+		if !more {
+			return Site{}
+		}
+	}
+}
+
+// Returns the frame that raised the panic currently being recovered.
+// It is the first frame following runtime.gopanic that is neither in the
+// runtime nor in this package.
+func panicSite() Site {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		switch {
+		case frame.Function == "runtime.gopanic":
+			panicking = true
+		case panicking && !strings.HasPrefix(frame.Function, "runtime.") && !inPackage(frame.Function):
+			return Site{frame.File, frame.Line, frame.Function}
+		}
+		if !more {
+			return Site{}
+		}
+	}
+}
+
+// Returns true if the (package qualified) function name 'fname' is
+// defined in this package or one of its sub-packages, excluding external
+// test packages.
+func inPackage(fname string) bool {
+	fpkg := funcPackage(fname)
+	if strings.HasSuffix(fpkg, "_test") {
+		return false
+	}
+	return fpkg == pkgpath || strings.HasPrefix(fpkg, pkgpath+"/")
+}
+
+// Returns the package path of the (package qualified) function name
+// 'fname', or "" if not qualified.
+func funcPackage(fname string) string {
+	// e.g. github.com/elasticsearch/kriterium/panics.(*fnpanics).OnNil
+	slash := strings.LastIndex(fname, "/")
+	dot := strings.Index(fname[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	return fname[:slash+1+dot]
+}
@@ -0,0 +1,158 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"math/rand"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// panics.Retry
+// -----------------------------------------------------------------------
+
+// RetrySpec specifies the retryable errors, attempt limit and backoff of
+// Retry().
+type RetrySpec struct {
+	// Max number of attempts. Defaults to 3.
+	MaxAttempts int
+	// Delay before the second attempt. Doubled for every further attempt,
+	// up to MaxBackoff. Zero for no delay.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Fraction of the delay (0 to 1) that is randomized, so that clients
+	// do not retry in lock step. e.g. a Jitter of 0.5 for a delay of 1s
+	// waits between 0.5s and 1s.
+	Jitter float64
+	// Errors that match any of the Retryable TypedErrors, or for which
+	// RetryIf returns true, are retried. If neither is set, all errors
+	// are retried.
+	Retryable []errors.TypedError
+	RetryIf   func(e error) bool
+}
+
+// Runs input arg 'fn' until it succeeds, fails with an error that is not
+// retryable, or the max number of attempts is reached. A panic in 'fn' is
+// recovered per Recover() and retried as any other error:
+//
+//    e := panics.Retry(ctx, panics.RetrySpec{
+//        MaxAttempts: 5,
+//        Backoff:     100 * time.Millisecond,
+//        MaxBackoff:  2 * time.Second,
+//        Jitter:      0.5,
+//        Retryable:   []errors.TypedError{ErrIO},
+//    }, func(ctx context.Context) error {
+//        data := panics.Must(fetch(ctx, url))
+//        ...
+//        return nil
+//    })
+//
+// If 'fn' fails, returns an errors.Retry error with the number of attempts,
+// with the error of the last attempt as its cause, so that
+// errors.RootCause() and errors.As() of the standard library consider the
+// last attempt. The errors.Multiple error of all attempts, per
+// errors.Join(), is a second branch of its cause tree, so that
+// TypedError.Matches() and errors.Find() consider the errors of all
+// attempts. If 'ctx' is done while waiting to retry, returns an error per
+// OnDone() instead, with the errors.Retry error of the attempts so far as
+// its cause.
+func Retry(ctx context.Context, spec RetrySpec, fn func(ctx context.Context) error) error {
+	if spec.MaxAttempts <= 0 {
+		spec.MaxAttempts = 3
+	}
+	if spec.MaxBackoff < spec.Backoff {
+		spec.MaxBackoff = spec.Backoff
+	}
+
+	var attempts []error
+	delay := spec.Backoff
+	for n := 1; ; n++ {
+		e := runRetried(ctx, fn)
+		if e == nil {
+			return nil
+		}
+		attempts = append(attempts, e)
+		if n == spec.MaxAttempts || !spec.retryable(e) {
+			return retryError(n, attempts)
+		}
+		if !spec.wait(ctx, delay) {
+			return doneType(ctx)("retry:", retryError(n, attempts), context.Cause(ctx))
+		}
+		if delay *= 2; delay > spec.MaxBackoff {
+			delay = spec.MaxBackoff
+		}
+	}
+}
+
+func runRetried(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer Recover(&err)
+	return fn(ctx)
+}
+
+func (spec *RetrySpec) retryable(e error) bool {
+	if len(spec.Retryable) == 0 && spec.RetryIf == nil {
+		return true
+	}
+	for _, te := range spec.Retryable {
+		if te.Matches(e) {
+			return true
+		}
+	}
+	return spec.RetryIf != nil && spec.RetryIf(e)
+}
+
+// waits 'delay', with jitter. Returns false if 'ctx' is done first.
+func (spec *RetrySpec) wait(ctx context.Context, delay time.Duration) bool {
+	if jitter := time.Duration(spec.Jitter * float64(delay)); jitter > 0 {
+		delay -= time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func retryError(n int, attempts []error) error {
+	last := attempts[len(attempts)-1]
+	return &retried{errors.Retry(fmt.Sprintf("%d attempt(s):", n), last), errors.Join(attempts...)}
+}
+
+// error of a failed Retry(), with two causes: the errors.Retry error of
+// the last attempt, and the errors.Multiple error of all attempts.
+type retried struct {
+	last     error
+	attempts error
+}
+
+func (e *retried) Error() string {
+	return e.last.Error()
+}
+
+func (e *retried) Unwrap() []error {
+	return []error{e.last, e.attempts}
+}
@@ -0,0 +1,111 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"testing"
+	"time"
+)
+
+var errFlaky = errors.New("flaky error")
+
+// cause of the errFlaky error of attempt n
+type attemptError struct {
+	n int
+}
+
+func (e *attemptError) Error() string {
+	return fmt.Sprintf("attempt %d", e.n)
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	attempts := 0
+	fn := func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			panics.OnError(errFlaky("attempt", attempts))
+		}
+		return nil
+	}
+	spec := panics.RetrySpec{MaxAttempts: 3, Backoff: time.Millisecond, Jitter: 0.5, Retryable: []errors.TypedError{errFlaky}}
+	if e := panics.Retry(context.Background(), spec, fn); e != nil || attempts != 3 {
+		t.Fatalf("Retry - expected:(nil, 3) have:(%v, %d)", e, attempts)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	attempts := 0
+	fn := func(ctx context.Context) error {
+		attempts++
+		return errFlaky("attempt", &attemptError{attempts})
+	}
+	e := panics.Retry(context.Background(), panics.RetrySpec{MaxAttempts: 4}, fn)
+	if !errors.Retry.Matches(e) || !errFlaky.Matches(e) || attempts != 4 {
+		t.Fatalf("Retry - unexpected:(%v, %d)", e, attempts)
+	}
+	multi := errors.Find(e, errors.Multiple)
+	if errs := errors.Errors(multi); len(errs) != 4 {
+		t.Fatalf("expected 4 attempt errors have:%v", multi)
+	}
+	if root, ok := errors.RootCause(e).(*attemptError); !ok || root.n != 4 {
+		t.Fatalf("RootCause - expected attempt 4 have:%v", errors.RootCause(e))
+	}
+	var attempt *attemptError
+	if !stderrors.As(e, &attempt) || attempt.n != 4 {
+		t.Fatalf("errors.As - expected attempt 4 have:%v", attempt)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	attempts := 0
+	fn := func(ctx context.Context) error {
+		attempts++
+		panics.OnNilAs(errors.IllegalArgument, nil, "arg")
+		return nil
+	}
+	spec := panics.RetrySpec{
+		MaxAttempts: 5,
+		RetryIf:     func(e error) bool { return !errors.IllegalArgument.Matches(e) },
+	}
+	if e := panics.Retry(context.Background(), spec, fn); !errors.IllegalArgument.Matches(e) || attempts != 1 {
+		t.Fatalf("Retry - unexpected:(%v, %d)", e, attempts)
+	}
+}
+
+func TestRetryContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	attempts := 0
+	fn := func(ctx context.Context) error {
+		attempts++
+		return errFlaky()
+	}
+	e := panics.Retry(ctx, panics.RetrySpec{MaxAttempts: 100, Backoff: time.Hour}, fn)
+	if !errors.DeadlineExceeded.Matches(e) || !errors.Retry.Matches(e) || attempts != 1 {
+		t.Fatalf("Retry - unexpected:(%v, %d)", e, attempts)
+	}
+	multi := errors.Find(e, errors.Multiple)
+	if errs := errors.Errors(multi); len(errs) != 1 || !errFlaky.Matches(errs[0]) {
+		t.Fatalf("expected 1 attempt error have:%v", multi)
+	}
+}
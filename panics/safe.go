@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// panics.SafeFunc - callback boundaries
+// -----------------------------------------------------------------------
+
+// Callback specifies the identity and time budget of a callback wrapped
+// per SafeFunc0(), SafeFunc1() or SafeFunc2(). The safe wrappers guard
+// library code that calls user supplied callbacks (hooks, comparators,
+// visitors, plugins) against panics in the callbacks:
+//
+//    less := panics.SafeFunc2(userLess, panics.Callback{Name: "less", Budget: time.Millisecond})
+//    ...
+//    if before, e := less(a, b); e != nil {
+//        ...
+//    }
+//
+// A panic in the callback is recovered per Recover() and returned as an
+// errors.Callback error, tagged with the name of the callback, with the
+// recovered error as cause. The result is then the zero value.
+//
+// A call that exceeds the time budget returns an errors.Callback error with
+// an errors.DeadlineExceeded cause, along with the (late) result, so that
+// callers may accept late results. Calls are not interrupted: a budget
+// overrun is detected once the callback returns.
+type Callback struct {
+	// Name of the callback in errors. Defaults to the (package qualified)
+	// function name.
+	Name string
+	// Time budget of a call. Zero for no budget.
+	Budget time.Duration
+}
+
+// Returns the panic-safe analog of callback 'fn'. See Callback.
+func SafeFunc0[R any](fn func() R, spec ...Callback) func() (R, error) {
+	cb := newCallback(fn, spec)
+	return func() (r R, err error) {
+		err = cb.call(func() { r = fn() })
+		return
+	}
+}
+
+// Returns the panic-safe analog of callback 'fn'. See Callback.
+func SafeFunc1[A, R any](fn func(A) R, spec ...Callback) func(A) (R, error) {
+	cb := newCallback(fn, spec)
+	return func(a A) (r R, err error) {
+		err = cb.call(func() { r = fn(a) })
+		return
+	}
+}
+
+// Returns the panic-safe analog of callback 'fn'. See Callback.
+func SafeFunc2[A, B, R any](fn func(A, B) R, spec ...Callback) func(A, B) (R, error) {
+	cb := newCallback(fn, spec)
+	return func(a A, b B) (r R, err error) {
+		err = cb.call(func() { r = fn(a, b) })
+		return
+	}
+}
+
+func newCallback(fn interface{}, spec []Callback) Callback {
+	var cb Callback
+	if len(spec) > 0 {
+		cb = spec[0]
+	}
+	if cb.Name == "" {
+		if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+			cb.Name = f.Name()
+		} else {
+			cb.Name = "callback"
+		}
+	}
+	return cb
+}
+
+// runs the callback per 'run' and returns the callback error, if any.
+func (cb Callback) call(run func()) error {
+	start := time.Now()
+	if e := runCallback(run); e != nil {
+		return errors.Callback(cb.Name+":", e)
+	}
+	if cb.Budget <= 0 {
+		return nil
+	}
+	if elapsed := time.Since(start); elapsed > cb.Budget {
+		cause := errors.DeadlineExceeded(fmt.Sprintf("budget %s exceeded: took %s", cb.Budget, elapsed))
+		return errors.Callback(cb.Name+":", cause)
+	}
+	return nil
+}
+
+func runCallback(run func()) (err error) {
+	defer Recover(&err)
+	run()
+	return
+}
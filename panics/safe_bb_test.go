@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func userLess(a, b int) bool {
+	panics.OnTrue(a == b, "no ties")
+	return a < b
+}
+
+func TestSafeFunc(t *testing.T) {
+	less := panics.SafeFunc2(userLess)
+	if before, e := less(1, 2); e != nil || !before {
+		t.Fatalf("less - expected:(true, nil) have:(%t, %v)", before, e)
+	}
+	before, e := less(1, 1)
+	if !errors.Callback.Matches(e) || !errors.Assertion.Matches(e) || before {
+		t.Fatalf("less - expected callback error have:(%t, %v)", before, e)
+	}
+	if !strings.Contains(e.Error(), "userLess") {
+		t.Fatalf("expected callback name in error have:%q", e)
+	}
+
+	visit := panics.SafeFunc1(func(s []int) int { return s[len(s)] }, panics.Callback{Name: "visitor"})
+	if _, e := visit([]int{1}); !errors.Runtime.Matches(e) || !strings.Contains(e.Error(), "visitor:") {
+		t.Fatalf("visit - expected named runtime error have:%v", e)
+	}
+
+	hook := panics.SafeFunc0(func() string { return "ok" })
+	if v, e := hook(); e != nil || v != "ok" {
+		t.Fatalf("hook - expected:(ok, nil) have:(%s, %v)", v, e)
+	}
+}
+
+func TestSafeFuncBudget(t *testing.T) {
+	slow := panics.SafeFunc0(func() int {
+		time.Sleep(20 * time.Millisecond)
+		return 42
+	}, panics.Callback{Name: "slow", Budget: time.Millisecond})
+
+	v, e := slow()
+	if !errors.Callback.Matches(e) || !errors.DeadlineExceeded.Matches(e) || v != 42 {
+		t.Fatalf("slow - expected budget overrun with late result have:(%d, %v)", v, e)
+	}
+}
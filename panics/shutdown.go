@@ -0,0 +1,219 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// signals and graceful shutdown
+// -----------------------------------------------------------------------
+
+// Process exit codes, per Shutdown.
+const (
+	ExitOK      = 0
+	ExitFailure = 1   // a recovered panic, per ExitHandler(), or a failed shutdown hook
+	ExitTimeout = 124 // shutdown hooks did not complete by the deadline
+	// a terminating signal exits with code ExitSignal + signal number,
+	// e.g. 130 for SIGINT and 143 for SIGTERM
+	ExitSignal = 128
+)
+
+// Shutdown handles SIGINT and SIGTERM by canceling a root context,
+// running shutdown hooks and exiting, and SIGQUIT by logging the stacks
+// of all goroutines (without exiting):
+//
+//    func main() {
+//        defer panics.ExitHandler("my-server")
+//        shutdown, ctx := panics.HandleSignals(context.Background(), 10*time.Second)
+//        server := start(ctx)
+//        shutdown.OnShutdown("server", server.Close)
+//        ...
+//        <-ctx.Done()
+//    }
+//
+// Shutdown hooks are run in reverse order of registration, i.e. the last
+// registered hook is run first, with a context that expires at the
+// deadline. Panics in hooks are recovered per Recover().
+//
+// ExitHandler() also runs the shutdown hooks of the active Shutdown before
+// it exits, i.e. when main returns or panics.
+type Shutdown struct {
+	timeout time.Duration
+	cancel  context.CancelCauseFunc
+	signals chan os.Signal
+	stop    chan struct{}
+
+	mu       sync.Mutex
+	hooks    []shutdownHook
+	stopOnce sync.Once
+	once     sync.Once
+	started  int32
+}
+
+type shutdownHook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// the active Shutdown, if any
+var activeShutdown atomic.Pointer[Shutdown]
+
+// Starts handling SIGINT, SIGTERM and SIGQUIT per the returned (active)
+// Shutdown, and returns a root context derived from 'ctx' that is
+// canceled on shutdown. Shutdown hooks must complete within 'timeout'.
+// Defaults to 10s.
+func HandleSignals(ctx context.Context, timeout time.Duration) (*Shutdown, context.Context) {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	s := &Shutdown{
+		timeout: timeout,
+		cancel:  cancel,
+		signals: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+	}
+	signal.Notify(s.signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	if previous := activeShutdown.Swap(s); previous != nil {
+		previous.Stop()
+	}
+	go s.handle()
+	return s, ctx
+}
+
+// Registers a named shutdown hook. See Shutdown.
+func (s *Shutdown) OnShutdown(name string, hook func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, shutdownHook{name, hook})
+}
+
+// Stops signal handling. Shutdown hooks are not run.
+func (s *Shutdown) Stop() {
+	s.stopOnce.Do(func() {
+		signal.Stop(s.signals)
+		close(s.stop)
+		activeShutdown.CompareAndSwap(s, nil)
+	})
+}
+
+// Cancels the root context, runs the shutdown hooks and exits the process
+// with the given exit code, per os.Exit(). If the hooks fail or do not
+// complete by the deadline, an exit code of ExitOK becomes ExitFailure or
+// ExitTimeout respectively.
+//
+// Shutdown never returns: concurrent or repeated calls wait for the exit
+// of the first call.
+func (s *Shutdown) Shutdown(code int) {
+	s.once.Do(func() {
+		atomic.StoreInt32(&s.started, 1)
+		s.cancel(errors.Canceled("shutdown: exit code", code))
+		os.Exit(s.runHooks(code))
+	})
+	select {}
+}
+
+func (s *Shutdown) handle() {
+	for {
+		select {
+		case sig := <-s.signals:
+			if sig == syscall.SIGQUIT {
+				log.Printf("panics: %s: goroutine stacks:\n%s", sig, allStacks())
+				continue
+			}
+			code := exitCode(sig)
+			if atomic.LoadInt32(&s.started) != 0 {
+				// a repeated signal while shutting down: exit now
+				log.Printf("panics: %s: exit during shutdown", sig)
+				os.Exit(code)
+			}
+			log.Printf("panics: %s: shutting down", sig)
+			go s.Shutdown(code)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// runs the hooks in reverse order and returns the exit code.
+func (s *Shutdown) runHooks(code int) int {
+	s.mu.Lock()
+	hooks := make([]shutdownHook, len(s.hooks))
+	copy(hooks, s.hooks)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	failed := make(chan bool, 1)
+	go func() {
+		ok := true
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if e := runHook(ctx, hooks[i].fn); e != nil {
+				log.Printf("panics: shutdown hook %s: %s", hooks[i].name, e)
+				ok = false
+			}
+		}
+		failed <- !ok
+	}()
+
+	select {
+	case hookFailed := <-failed:
+		if hookFailed && code == ExitOK {
+			code = ExitFailure
+		}
+	case <-ctx.Done():
+		log.Printf("panics: shutdown hooks: %s", doneError(ctx, fmt.Sprintf("timeout %s:", s.timeout)))
+		if code == ExitOK {
+			code = ExitTimeout
+		}
+	}
+	return code
+}
+
+func runHook(ctx context.Context, hook func(ctx context.Context) error) (err error) {
+	defer Recover(&err)
+	return hook(ctx)
+}
+
+// Returns the exit code for the terminating signal 'sig'.
+func exitCode(sig os.Signal) int {
+	if n, ok := sig.(syscall.Signal); ok {
+		return ExitSignal + int(n)
+	}
+	return ExitFailure
+}
+
+// Exits the process with the given exit code, per the active Shutdown, if
+// any, or per os.Exit().
+func exit(code int) {
+	if s := activeShutdown.Load(); s != nil {
+		s.Shutdown(code)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !windows
+
+package panics_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/panics"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// shutdown test child process scenarios
+const shutdownChildEnv = "KRITERIUM_TEST_SHUTDOWN_CHILD"
+
+// runs the scenario of the calling test in a child process, and returns
+// its exit code and output.
+func runShutdownChild(t *testing.T, scenario string) (int, string) {
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$")
+	cmd.Env = append(os.Environ(), shutdownChildEnv+"="+scenario)
+	out, e := cmd.CombinedOutput()
+	if ee, ok := e.(*exec.ExitError); ok {
+		return ee.ExitCode(), string(out)
+	}
+	if e != nil {
+		t.Fatalf("child process failed: %s\n%s", e, out)
+	}
+	return 0, string(out)
+}
+
+func signalSelf(t *testing.T, sig os.Signal) {
+	if e := syscall.Kill(os.Getpid(), sig.(syscall.Signal)); e != nil {
+		t.Fatal(e)
+	}
+}
+
+// registers hooks that print their name
+func printingHooks(s *panics.Shutdown, names ...string) {
+	for _, name := range names {
+		name := name
+		s.OnShutdown(name, func(ctx context.Context) error {
+			fmt.Println("hook", name)
+			return nil
+		})
+	}
+}
+
+func TestShutdownOnSignal(t *testing.T) {
+	if os.Getenv(shutdownChildEnv) == "signal" {
+		s, ctx := panics.HandleSignals(context.Background(), time.Second)
+		printingHooks(s, "first", "second")
+		s.OnShutdown("canceled", func(_ context.Context) error {
+			if ctx.Err() == nil {
+				return fmt.Errorf("root context not canceled")
+			}
+			return nil
+		})
+		signalSelf(t, syscall.SIGTERM)
+		time.Sleep(5 * time.Second)
+		t.Fatal("expected exit")
+	}
+
+	code, out := runShutdownChild(t, "signal")
+	if code != panics.ExitSignal+int(syscall.SIGTERM) {
+		t.Fatalf("expected exit code %d have:%d\n%s", panics.ExitSignal+int(syscall.SIGTERM), code, out)
+	}
+	second, first := strings.Index(out, "hook second"), strings.Index(out, "hook first")
+	if second < 0 || first < second || strings.Contains(out, "not canceled") {
+		t.Fatalf("expected hooks in reverse order - have:\n%s", out)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	if os.Getenv(shutdownChildEnv) == "timeout" {
+		defer panics.ExitHandler("timeout")
+		s, _ := panics.HandleSignals(context.Background(), 50*time.Millisecond)
+		s.OnShutdown("stuck", func(ctx context.Context) error {
+			time.Sleep(5 * time.Second)
+			return nil
+		})
+		return
+	}
+
+	code, out := runShutdownChild(t, "timeout")
+	if code != panics.ExitTimeout || !strings.Contains(out, "deadline exceeded") {
+		t.Fatalf("expected exit code %d have:%d\n%s", panics.ExitTimeout, code, out)
+	}
+}
+
+func TestShutdownOnPanic(t *testing.T) {
+	if os.Getenv(shutdownChildEnv) == "panic" {
+		defer panics.ExitHandler("panic")
+		s, _ := panics.HandleSignals(context.Background(), time.Second)
+		printingHooks(s, "cleanup")
+		panics.OnFalse(false, "child panic")
+		return
+	}
+
+	code, out := runShutdownChild(t, "panic")
+	if code != panics.ExitFailure || !strings.Contains(out, "hook cleanup") || !strings.Contains(out, "child panic") {
+		t.Fatalf("expected exit code %d have:%d\n%s", panics.ExitFailure, code, out)
+	}
+}
+
+// a log writer that is safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSIGQUITDumpsStacks(t *testing.T) {
+	var logged syncBuffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	s, ctx := panics.HandleSignals(context.Background(), time.Second)
+	defer s.Stop()
+	signalSelf(t, syscall.SIGQUIT)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(logged.String(), "goroutine stacks") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected stack dump - have:%q", logged.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("expected SIGQUIT not to shut down")
+	}
+}
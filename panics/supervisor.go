@@ -0,0 +1,319 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"context"
+	"fmt"
+	"github.com/elasticsearch/kriterium/errors"
+	"time"
+)
+
+// -----------------------------------------------------------------------
+// panics.Supervisor
+// -----------------------------------------------------------------------
+
+// Restart strategy of a Supervisor.
+type Strategy int
+
+const (
+	OneForOne  Strategy = iota // restart the failed child only
+	OneForAll                  // restart all children
+	RestForOne                 // restart the failed child and all children added after it
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one-for-one"
+	case OneForAll:
+		return "one-for-all"
+	case RestForOne:
+		return "rest-for-one"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// SupervisorSpec specifies the restart strategy, restart intensity and
+// restart backoff of a Supervisor.
+type SupervisorSpec struct {
+	Strategy Strategy
+	// Max number of restarts in any Period. If exceeded, the supervisor
+	// terminates all children and fails. A negative value disables the
+	// limit.
+	MaxRestarts int
+	// Restart intensity period. Defaults to 5s.
+	Period time.Duration
+	// Delay before the first restart in a Period. Doubled for every
+	// further restart in the Period, up to MaxBackoff. Zero for no delay.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Supervisor runs child workers in goroutines, recovers their panics and
+// restarts failed children per the (Erlang style) restart strategy of its
+// SupervisorSpec.
+//
+// A child fails if it panics or returns an error. A child that returns nil
+// has completed and is not restarted.
+//
+//    sup := panics.NewSupervisor(panics.SupervisorSpec{
+//        Strategy:    panics.OneForOne,
+//        MaxRestarts: 3,
+//        Period:      time.Minute,
+//        Backoff:     100 * time.Millisecond,
+//        MaxBackoff:  5 * time.Second,
+//    })
+//    sup.Add("listener", listen)
+//    sup.Add("indexer", index)
+//    ...
+//    e := sup.Run(ctx)
+//    if errors.Supervision.Matches(e) {
+//        ...
+//    }
+type Supervisor struct {
+	spec     SupervisorSpec
+	children []supervised
+}
+
+type supervised struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Returns a new Supervisor per SupervisorSpec 'spec'.
+func NewSupervisor(spec SupervisorSpec) *Supervisor {
+	if spec.Period <= 0 {
+		spec.Period = 5 * time.Second
+	}
+	if spec.MaxBackoff < spec.Backoff {
+		spec.MaxBackoff = spec.Backoff
+	}
+	return &Supervisor{spec: spec}
+}
+
+// Adds a named child. Children are started in the order added. Children
+// must return when their context is done.
+//
+// Add must not be called once Run() has been called.
+func (s *Supervisor) Add(name string, fn func(ctx context.Context) error) *Supervisor {
+	s.children = append(s.children, supervised{name, fn})
+	return s
+}
+
+// child exit event
+type childExit struct {
+	idx int
+	err error
+}
+
+// child run state
+type childState struct {
+	running   bool
+	completed bool
+	cancel    context.CancelFunc
+}
+
+// Runs all children and supervises them until either:
+//
+// - all children have completed. Returns nil.
+//
+// - input arg 'ctx' is done. All children are stopped and ctx.Err() is
+// returned.
+//
+// - the restart intensity is exceeded. All children are stopped and an
+// errors.Supervision error with the last child failure as cause is
+// returned.
+func (s *Supervisor) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &supervision{
+		Supervisor: s,
+		ctx:        ctx,
+		states:     make([]childState, len(s.children)),
+		exits:      make(chan childExit, len(s.children)),
+	}
+	for i := range s.children {
+		r.start(i)
+	}
+
+	for r.running > 0 {
+		var ex childExit
+		if len(r.pending) > 0 {
+			ex, r.pending = r.pending[0], r.pending[1:]
+		} else {
+			select {
+			case <-ctx.Done():
+				r.stop(r.runningSet())
+				return ctx.Err()
+			case ex = <-r.exits:
+			}
+		}
+		r.exited(ex)
+		if ex.err == nil {
+			r.states[ex.idx].completed = true
+			continue
+		}
+
+		if !r.restartAllowed(time.Now()) {
+			r.stop(r.runningSet())
+			return errors.Supervision("restart intensity exceeded - child", s.children[ex.idx].name, "failed:", ex.err)
+		}
+
+		restart := r.restartSet(ex.idx)
+		r.stop(restart)
+		if !r.backoff() {
+			r.stop(r.runningSet())
+			return ctx.Err()
+		}
+		for _, i := range restart {
+			r.start(i)
+		}
+	}
+	return nil
+}
+
+// state of a Supervisor.Run
+type supervision struct {
+	*Supervisor
+	ctx      context.Context
+	states   []childState
+	exits    chan childExit
+	pending  []childExit // exits received while stopping other children
+	running  int
+	restarts []time.Time // within the current period
+}
+
+func (r *supervision) start(i int) {
+	cctx, cancel := context.WithCancel(r.ctx)
+	r.states[i] = childState{running: true, cancel: cancel}
+	r.running++
+
+	fn := r.children[i].fn
+	go func() {
+		r.exits <- childExit{i, runSupervised(cctx, fn)}
+	}()
+}
+
+func runSupervised(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer Recover(&err)
+	return fn(ctx)
+}
+
+func (r *supervision) exited(ex childExit) {
+	st := &r.states[ex.idx]
+	st.running = false
+	st.cancel()
+	r.running--
+}
+
+// stops the running children in 'set' and waits for them to exit.
+func (r *supervision) stop(set []int) {
+	waiting := make(map[int]bool)
+	for _, i := range set {
+		if r.states[i].running {
+			r.states[i].cancel()
+			waiting[i] = true
+		}
+	}
+	pending := r.pending[:0]
+	for _, ex := range r.pending {
+		if waiting[ex.idx] {
+			delete(waiting, ex.idx)
+			r.exited(ex)
+			continue
+		}
+		pending = append(pending, ex)
+	}
+	r.pending = pending
+	for len(waiting) > 0 {
+		ex := <-r.exits
+		if waiting[ex.idx] {
+			delete(waiting, ex.idx)
+			r.exited(ex)
+			continue
+		}
+		r.pending = append(r.pending, ex)
+	}
+}
+
+func (r *supervision) runningSet() []int {
+	var set []int
+	for i, st := range r.states {
+		if st.running {
+			set = append(set, i)
+		}
+	}
+	return set
+}
+
+// returns the children to restart, per strategy, on failure of child 'idx'.
+func (r *supervision) restartSet(idx int) []int {
+	set := []int{idx}
+	for i, st := range r.states {
+		if i == idx || st.completed {
+			continue
+		}
+		switch r.spec.Strategy {
+		case OneForAll:
+			set = append(set, i)
+		case RestForOne:
+			if i > idx {
+				set = append(set, i)
+			}
+		}
+	}
+	return set
+}
+
+// records a restart at time 'now' and returns false if the restart
+// intensity is exceeded.
+func (r *supervision) restartAllowed(now time.Time) bool {
+	var recent []time.Time
+	for _, t := range r.restarts {
+		if now.Sub(t) < r.spec.Period {
+			recent = append(recent, t)
+		}
+	}
+	r.restarts = append(recent, now)
+	return r.spec.MaxRestarts < 0 || len(r.restarts) <= r.spec.MaxRestarts
+}
+
+// waits per backoff policy. Returns false if the context is done.
+func (r *supervision) backoff() bool {
+	if r.spec.Backoff <= 0 {
+		return r.ctx.Err() == nil
+	}
+	delay := r.spec.Backoff
+	for n := 1; n < len(r.restarts) && delay < r.spec.MaxBackoff; n++ {
+		delay *= 2
+	}
+	if delay > r.spec.MaxBackoff {
+		delay = r.spec.MaxBackoff
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-r.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"context"
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// returns a child that panics on its first 'failures' runs and then
+// completes. Runs are counted in 'starts'.
+func flakyChild(starts *int32, failures int32) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		n := atomic.AddInt32(starts, 1)
+		panics.OnTrue(n <= failures, "flaky run", n)
+		return nil
+	}
+}
+
+// returns a child that runs until its context is done. Runs are counted
+// in 'starts'.
+func blockingChild(starts *int32) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		atomic.AddInt32(starts, 1)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+func TestSupervisorOneForOne(t *testing.T) {
+	var flaky, other int32
+	sup := panics.NewSupervisor(panics.SupervisorSpec{
+		Strategy:    panics.OneForOne,
+		MaxRestarts: 5,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  4 * time.Millisecond,
+	})
+	sup.Add("flaky", flakyChild(&flaky, 3))
+	sup.Add("other", flakyChild(&other, 0))
+
+	if e := sup.Run(context.Background()); e != nil {
+		t.Fatalf("Run - unexpected error: %s", e)
+	}
+	if flaky != 4 || other != 1 {
+		t.Fatalf("starts - expected:(4, 1) have:(%d, %d)", flaky, other)
+	}
+}
+
+func TestSupervisorStrategies(t *testing.T) {
+	var tests = []struct {
+		strategy panics.Strategy
+		expected [3]int32
+	}{
+		{panics.OneForOne, [3]int32{1, 2, 1}},
+		{panics.OneForAll, [3]int32{2, 2, 2}},
+		{panics.RestForOne, [3]int32{1, 2, 2}},
+	}
+	for _, test := range tests {
+		var starts [3]int32
+		ctx, cancel := context.WithCancel(context.Background())
+		sup := panics.NewSupervisor(panics.SupervisorSpec{Strategy: test.strategy, MaxRestarts: 1})
+		sup.Add("first", blockingChild(&starts[0]))
+		sup.Add("flaky", func(ctx context.Context) error {
+			if atomic.AddInt32(&starts[1], 1) == 1 {
+				time.Sleep(10 * time.Millisecond) // let siblings start
+				panic("flaky")
+			}
+			cancel()
+			return nil
+		})
+		sup.Add("last", blockingChild(&starts[2]))
+
+		if e := sup.Run(ctx); e != context.Canceled {
+			t.Errorf("%s: Run - expected:%v have:%v", test.strategy, context.Canceled, e)
+		}
+		if starts != test.expected {
+			t.Errorf("%s: starts - expected:%v have:%v", test.strategy, test.expected, starts)
+		}
+	}
+}
+
+func TestSupervisorIntensity(t *testing.T) {
+	var starts int32
+	sup := panics.NewSupervisor(panics.SupervisorSpec{MaxRestarts: 2, Period: time.Minute})
+	sup.Add("failing", func(ctx context.Context) error {
+		atomic.AddInt32(&starts, 1)
+		return errors.IllegalState("always")
+	})
+
+	e := sup.Run(context.Background())
+	if !errors.Supervision.Matches(e) || errors.Find(e, errors.IllegalState) == nil {
+		t.Fatalf("Run - unexpected error: %v", e)
+	}
+	if starts != 3 {
+		t.Fatalf("starts - expected:%d have:%d", 3, starts)
+	}
+}
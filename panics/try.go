@@ -0,0 +1,101 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics
+
+import (
+	"github.com/elasticsearch/kriterium/errors"
+)
+
+// -----------------------------------------------------------------------
+// panics.Try
+// -----------------------------------------------------------------------
+
+// Try returns a Trial of input arg 'fn'. Trials provide try/catch/finally
+// semantics on top of Recover():
+//
+//    panics.Try(func() {
+//        data := panics.Must(ioutil.ReadFile(filename))
+//        ...
+//    }).Catch(ErrIO, func(e error) {
+//        log.Printf("read failed: %s", e)
+//    }).Catch(errors.IllegalState, func(e error) {
+//        ...
+//    }).Finally(func() {
+//        cleanup()
+//    }).Run()
+//
+// Nothing is run until Run() is invoked.
+func Try(fn func()) *Trial {
+	return &Trial{fn: fn}
+}
+
+// Trial is a function with registered error handlers and finalizers.
+// See Try().
+type Trial struct {
+	fn       func()
+	catchers []catcher
+	finals   []func()
+}
+
+type catcher struct {
+	te      errors.TypedError
+	handler func(e error)
+}
+
+// Registers a handler for errors matching TypedError 'te'. A nil 'te'
+// matches any error.
+func (t *Trial) Catch(te errors.TypedError, handler func(e error)) *Trial {
+	t.catchers = append(t.catchers, catcher{te, handler})
+	return t
+}
+
+// Registers a finalizer. Finalizers are always run, in LIFO order,
+// after the function and the error handler (if any) have run.
+func (t *Trial) Finally(fn func()) *Trial {
+	t.finals = append(t.finals, fn)
+	return t
+}
+
+// Runs the function of the trial. If the function panics, the recovered
+// error is dispatched to the first registered handler with a matching
+// TypedError. If there is no matching handler, the recovered error is
+// re-panicked. Finalizers run in either case, and even if a handler (or
+// another finalizer) panics.
+func (t *Trial) Run() {
+	for _, fn := range t.finals {
+		defer fn()
+	}
+
+	e := t.try()
+	if e == nil {
+		return
+	}
+	for _, c := range t.catchers {
+		if c.te == nil || c.te.Matches(e) {
+			c.handler(e)
+			return
+		}
+	}
+	panic(e)
+}
+
+func (t *Trial) try() (err error) {
+	defer Recover(&err)
+	t.fn()
+	return
+}
@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package panics_test
+
+import (
+	"github.com/elasticsearch/kriterium/errors"
+	"github.com/elasticsearch/kriterium/panics"
+	"reflect"
+	"testing"
+)
+
+func TestTry(t *testing.T) {
+	var trace []string
+	panics.Try(func() {
+		trace = append(trace, "try")
+		panics.OnFalseAs(errors.IllegalState, false)
+	}).Catch(errors.IllegalArgument, func(e error) {
+		trace = append(trace, "illegal-argument")
+	}).Catch(errors.IllegalState, func(e error) {
+		trace = append(trace, "illegal-state")
+	}).Catch(nil, func(e error) {
+		trace = append(trace, "any")
+	}).Finally(func() {
+		trace = append(trace, "finally-1")
+	}).Finally(func() {
+		trace = append(trace, "finally-2")
+	}).Run()
+
+	expected := []string{"try", "illegal-state", "finally-2", "finally-1"}
+	if !reflect.DeepEqual(trace, expected) {
+		t.Fatalf("Try - expected:%q have:%q", expected, trace)
+	}
+}
+
+func TestTryUnhandled(t *testing.T) {
+	finalized := false
+	e := recoverFrom(func() {
+		panics.Try(func() {
+			panics.OnNil(nil, "unhandled")
+		}).Catch(errors.IllegalState, func(e error) {
+			t.Error("unexpected handler call")
+		}).Finally(func() {
+			finalized = true
+		}).Run()
+	})
+	if !errors.Assertion.Matches(e) {
+		t.Fatalf("expected re-panicked assertion error, have: %v", e)
+	}
+	if !finalized {
+		t.Fatal("expected finalizer to run")
+	}
+}